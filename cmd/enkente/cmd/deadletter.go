@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
+	"github.com/gnomatix/enkente/pkg/storage"
+	"github.com/spf13/cobra"
+)
+
+// Sources recorded on dead letters, naming the command that received the
+// message.
+const (
+	sourceTail = "tail"
+	sourceAPI  = "api"
+)
+
+var (
+	redriveWorkers int
+	redriveRetries int
+)
+
+var deadLetterCmd = &cobra.Command{
+	Use:   "deadletter",
+	Short: "Inspect and re-drive messages whose handler failed",
+	Long: `Messages that fail every attempt in the worker pool of tail or serve are
+kept in the datastore's dead-letter bucket along with the error, the number
+of attempts and the worker that handled them.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Usage()
+	},
+}
+
+var deadLetterListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List dead-lettered messages",
+	Run: func(cmd *cobra.Command, args []string) {
+		store := mustOpenStore("deadletter list")
+		defer store.Close()
+
+		letters, err := store.ListDeadLetters()
+		if err != nil {
+			log.Fatalf("Failed to list dead letters: %v", err)
+		}
+		if len(letters) == 0 {
+			fmt.Println("No dead letters")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tFAILED\tSOURCE\tMESSAGE\tATTEMPTS\tERROR")
+		for _, dl := range letters {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s/%d\t%d\t%s\n",
+				dl.ID, dl.FailedAt.Local().Format(time.DateTime), dl.Source,
+				dl.Message.SessionID, dl.Message.MessageID, dl.Attempts, firstLine(dl.Error, 60))
+		}
+		w.Flush()
+	},
+}
+
+var deadLetterShowCmd = &cobra.Command{
+	Use:   "show <id>",
+	Short: "Show a dead-lettered message in full",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := strconv.ParseUint(args[0], 10, 64)
+		if err != nil {
+			log.Fatalf("Invalid dead letter id %q", args[0])
+		}
+
+		store := mustOpenStore("deadletter show")
+		defer store.Close()
+
+		dl, err := store.GetDeadLetter(id)
+		if err != nil {
+			log.Fatalf("Failed to read dead letter: %v", err)
+		}
+		if dl == nil {
+			log.Fatalf("No dead letter with id %d", id)
+		}
+
+		out, _ := json.MarshalIndent(dl, "", "  ")
+		fmt.Println(string(out))
+	},
+}
+
+var deadLetterRedriveCmd = &cobra.Command{
+	Use:   "redrive [id...]",
+	Short: "Send dead-lettered messages through the pipeline again",
+	Long: `Re-drives the given dead letters, or all of them if no ids are given.
+Messages that now succeed are removed from the dead-letter bucket; those that
+fail again stay there with the new error and their attempts added up.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store := mustOpenStore("deadletter redrive")
+		defer store.Close()
+
+		var letters []storage.DeadLetter
+		if len(args) == 0 {
+			all, err := store.ListDeadLetters()
+			if err != nil {
+				log.Fatalf("Failed to list dead letters: %v", err)
+			}
+			letters = all
+		}
+		for _, arg := range args {
+			id, err := strconv.ParseUint(arg, 10, 64)
+			if err != nil {
+				log.Fatalf("Invalid dead letter id %q", arg)
+			}
+			dl, err := store.GetDeadLetter(id)
+			if err != nil {
+				log.Fatalf("Failed to read dead letter %d: %v", id, err)
+			}
+			if dl == nil {
+				log.Fatalf("No dead letter with id %d", id)
+			}
+			letters = append(letters, *dl)
+		}
+
+		var (
+			mu                 sync.Mutex
+			succeeded, refails int
+		)
+		cfg := pipeline.Config[storage.DeadLetter]{
+			Workers:     redriveWorkers,
+			MaxAttempts: redriveRetries + 1,
+			Backoff:     100 * time.Millisecond,
+			MaxBackoff:  2 * time.Second,
+			OnFailure: func(workerID int, dl storage.DeadLetter, err error, attempts int) {
+				dl.Error = err.Error()
+				dl.Attempts += attempts
+				dl.WorkerID = workerID
+				dl.FailedAt = time.Time{}
+				if err := store.SaveDeadLetter(&dl); err != nil {
+					log.Printf("Failed to update dead letter %d: %v", dl.ID, err)
+				}
+			},
+		}
+		// The message event is recorded rather than sent, since serve,
+		// which would send it, cannot have the datastore open meanwhile.
+		handler := messageHandler(store, func(_ int, msg parser.AntigravityMessage) error {
+			return api.RecordMessage(store, msg)
+		})
+		pool := pipeline.New(context.Background(), cfg,
+			func(ctx context.Context, workerID int, dl storage.DeadLetter) error {
+				return handler(ctx, workerID, dl.Message)
+			})
+
+		for _, dl := range letters {
+			err := pool.SubmitFunc(context.Background(), dl, func(err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					refails++
+					return
+				}
+				succeeded++
+				if err := store.DeleteDeadLetter(dl.ID); err != nil {
+					log.Printf("Re-drove dead letter %d but could not remove it: %v", dl.ID, err)
+				}
+			})
+			if err != nil {
+				log.Fatalf("Failed to queue dead letter %d: %v", dl.ID, err)
+			}
+		}
+		pool.Shutdown(context.Background())
+
+		fmt.Printf("Re-drove %d dead letters, %d failed again\n", succeeded, refails)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(deadLetterCmd)
+	deadLetterCmd.AddCommand(deadLetterListCmd, deadLetterShowCmd, deadLetterRedriveCmd)
+	deadLetterRedriveCmd.Flags().IntVar(&redriveWorkers, "workers", 4, "Number of workers re-driving messages")
+	deadLetterRedriveCmd.Flags().IntVar(&redriveRetries, "retries", 2, "How many times to retry a message before dead-lettering it again")
+}
+
+// mustOpenStore opens the datastore for a command that cannot work without one.
+func mustOpenStore(command string) *storage.BoltStorage {
+	store, err := openStore()
+	if err != nil {
+		log.Fatalf("Failed to open datastore: %v", err)
+	}
+	if store == nil {
+		log.Fatalf("%s needs a datastore; pass --db", command)
+	}
+	return store
+}
+
+// messageHandler is the pipeline handler of tail, serve and deadletter
+// redrive: it saves each message to store, if there is one, then passes it on
+// to processed, which shows it in a TUI or publishes it.
+func messageHandler(store *storage.BoltStorage, processed func(workerID int, msg parser.AntigravityMessage) error) pipeline.Handler[parser.AntigravityMessage] {
+	return func(_ context.Context, workerID int, msg parser.AntigravityMessage) error {
+		if store != nil {
+			if err := store.SaveMessage(msg); err != nil {
+				return err
+			}
+		}
+		return processed(workerID, msg)
+	}
+}
+
+// deadLetter records a message that failed every attempt, folding any error
+// doing so into the one returned.
+func deadLetter(store *storage.BoltStorage, source string, workerID int, msg parser.AntigravityMessage, err error, attempts int) error {
+	dlErr := store.SaveDeadLetter(&storage.DeadLetter{
+		Message:  msg,
+		Source:   source,
+		Error:    err.Error(),
+		Attempts: attempts,
+		WorkerID: workerID,
+	})
+	if dlErr != nil {
+		return fmt.Errorf("%w (dead letter not saved: %v)", err, dlErr)
+	}
+	return err
+}
+
+// firstLine trims s to its first line and at most n runes.
+func firstLine(s string, n int) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	if r := []rune(s); len(r) > n {
+		s = string(r[:n-1]) + "…"
+	}
+	return s
+}
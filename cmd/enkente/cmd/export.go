@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/export"
+	"github.com/spf13/cobra"
+)
+
+var (
+	exportFormat    string
+	exportOutput    string
+	exportSession   string
+	exportRoot      string
+	exportDirection string
+	exportDepth     int
+	exportInterval  time.Duration
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the concept graph for visualization",
+	Long: `Writes the concept graph of --namespace in one of these formats:
+
+  node-link  JSON nodes and links, as read by d3-force and networkx
+  tree       JSON nesting the concepts reachable from --root under the
+             edge that first reaches each one
+  timeline   JSON grouping concepts by when they were introduced, in
+             buckets of --interval
+  graphml    GraphML, for yEd, Gephi and networkx
+  gexf       dynamic GEXF for Gephi, whose timeline replays when concepts
+             and edges appeared in the chat
+  dot        Graphviz DOT
+
+Concepts carry their kind and the user who introduced them, and edges
+their relation and weight. --session limits the export to the concepts and
+edges of one session. The JSON formats are also served by enkente serve at
+GET /export/{format}.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		dir, err := export.ParseDirection(exportDirection)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		store := mustOpenStore("export")
+		defer store.Close()
+
+		g, err := export.Load(store, exportSession)
+		if err != nil {
+			log.Fatalf("Failed to read graph: %v", err)
+		}
+
+		opts := export.Options{
+			Root:      exportRoot,
+			Direction: dir,
+			Depth:     exportDepth,
+			Interval:  exportInterval,
+		}
+		if exportOutput == "" || exportOutput == "-" {
+			if err := g.Write(os.Stdout, exportFormat, opts); err != nil {
+				log.Fatalf("Export failed: %v", err)
+			}
+			return
+		}
+
+		f, err := os.Create(exportOutput)
+		if err != nil {
+			log.Fatalf("Failed to create %s: %v", exportOutput, err)
+		}
+		err = g.Write(f, exportFormat, opts)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(exportOutput)
+			log.Fatalf("Export failed: %v", err)
+		}
+		fmt.Fprintf(os.Stderr, "Exported %d concepts and %d edges to %s\n", len(g.Concepts), len(g.Edges), exportOutput)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(exportCmd)
+	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", export.FormatNodeLink, "Export format: "+strings.Join(slices.Concat(export.Formats, export.FileFormats), ", "))
+	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "File to write to (default: stdout)")
+	exportCmd.Flags().StringVarP(&exportSession, "session", "s", "", "Only export what this session touched")
+	exportCmd.Flags().StringVar(&exportRoot, "root", "", "Concept a tree starts from")
+	exportCmd.Flags().StringVar(&exportDirection, "direction", "out", "Edges a tree follows from its root: out, in or both")
+	exportCmd.Flags().IntVar(&exportDepth, "depth", 0, "Levels below the root a tree goes (0 for no limit)")
+	exportCmd.Flags().DurationVar(&exportInterval, "interval", export.DefaultInterval, "Width of a timeline bucket")
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/spf13/cobra"
+)
+
+var (
+	importFile   string
+	importFormat string
+	importBatch  int
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import an Antigravity chat log into the datastore",
+	Long: `Streams an exported Antigravity chat log into the datastore without loading
+the whole file into memory, saving messages in batches as they are decoded.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("Failed to open datastore: %v", err)
+		}
+		if store == nil {
+			log.Fatal("import needs a datastore; pass --db")
+		}
+		defer store.Close()
+
+		if importBatch < 1 {
+			importBatch = 1
+		}
+
+		format := parser.LogFormat(importFormat)
+		if format == "" {
+			format = parser.DetectFormat(importFile)
+		}
+
+		var (
+			batch    = make([]parser.AntigravityMessage, 0, importBatch)
+			imported int
+		)
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+			if err := store.SaveMessages(batch); err != nil {
+				return err
+			}
+			imported += len(batch)
+			batch = batch[:0]
+			return nil
+		}
+		collect := func(msg parser.AntigravityMessage) error {
+			batch = append(batch, msg)
+			if len(batch) >= importBatch {
+				return flush()
+			}
+			return nil
+		}
+
+		switch format {
+		case parser.FormatJSON:
+			err = parser.ParseChatLogFileStream(importFile, collect)
+		case parser.FormatNDJSON:
+			err = parser.ParseNDJSONFileStream(importFile, collect)
+		default:
+			log.Fatalf("Unknown log format %q (want json or ndjson)", importFormat)
+		}
+		if err == nil {
+			err = flush()
+		}
+		if err != nil {
+			log.Fatalf("Import failed after %d messages: %v", imported, err)
+		}
+
+		fmt.Printf("Imported %d messages from %s\n", imported, importFile)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(importCmd)
+	importCmd.Flags().StringVarP(&importFile, "log", "l", "", "Path to the chat log to import")
+	importCmd.Flags().StringVarP(&importFormat, "format", "f", "", "Log format: json or ndjson (default: detect from extension)")
+	importCmd.Flags().IntVar(&importBatch, "batch", 500, "Number of messages saved per transaction")
+	importCmd.MarkFlagRequired("log")
+}
@@ -1,12 +1,20 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/gnomatix/enkente/pkg/storage"
 	"github.com/spf13/cobra"
 )
 
+var (
+	dbPath    string
+	namespace string
+)
+
 var rootCmd = &cobra.Command{
 	Use:   "enkente",
 	Short: "enkente is a multi-faceted mind-mapping datastore",
@@ -24,3 +32,48 @@ func Execute() {
 		os.Exit(1)
 	}
 }
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&dbPath, "db", "enkente.db", "Path to the BoltDB datastore (empty disables persistence)")
+	rootCmd.PersistentFlags().StringVarP(&namespace, "namespace", "n", "", "Namespace to scope data to, e.g. project/session")
+}
+
+// openStore opens the datastore named by --db, scoped to --namespace. It
+// returns nil without an error when persistence has been disabled with an
+// empty path.
+func openStore() (*storage.BoltStorage, error) {
+	if dbPath == "" {
+		return nil, nil
+	}
+	store, err := storage.NewBoltStorage(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	scoped, err := store.Namespace(storage.Namespace(namespace))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	return scoped, nil
+}
+
+// pruneStore drops expired idempotency keys from store every interval until
+// ctx is done, along with events older than eventRetention if that is
+// positive, so neither bucket grows without bound.
+func pruneStore(ctx context.Context, store *storage.BoltStorage, interval, eventRetention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			// Expired keys are ignored anyway and old events only take
+			// space; a failed prune is retried next time.
+			store.PurgeExpiredIdempotencyKeys(now.UTC())
+			if eventRetention > 0 {
+				store.TrimEvents(now.Add(-eventRetention))
+			}
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/charmbracelet/bubbles/viewport"
@@ -11,11 +15,23 @@ import (
 	"github.com/charmbracelet/lipgloss"
 	"github.com/gnomatix/enkente/pkg/api"
 	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
 	"github.com/gnomatix/enkente/pkg/theme"
 	"github.com/spf13/cobra"
 )
 
-var servePort int
+var (
+	servePort    int
+	serveOrdered bool
+	serveRetries int
+
+	serveShutdownTimeout time.Duration
+	serveQueueDepth      int
+	serveEnqueueTimeout  time.Duration
+	serveDedupTTL        time.Duration
+	serveEventRetention  time.Duration
+	serveAllowedOrigins  []string
+)
 
 var serveCmd = &cobra.Command{
 	Use:   "serve",
@@ -24,28 +40,117 @@ var serveCmd = &cobra.Command{
 incoming messages in a real-time BubbleTea TUI with the worker swarm.
 
 Send messages with:
-  curl -X POST http://localhost:8080/ingest -d '{"type":"user","message":"Hello!"}'`,
+  curl -X POST http://localhost:8080/ingest -d '{"sessionId":"demo","type":"user","message":"Hello!"}'
+
+Messages without a sessionId go to the "live" session. POST /sessions starts
+a session with a generated id. The 202 response carries the id each message
+was assigned.
+
+Backfill a transcript in one request with POST /ingest/batch, sending either
+a JSON array of messages or NDJSON with one message per line.
+
+Retries are safe: a message sent again with the same Idempotency-Key header,
+or the same clientMessageId in its session, is answered with the original
+ids and not stored twice.
+
+What has been stored can be read back, and the concept graph curated, over
+REST: GET /sessions, /sessions/{id}/messages[/{messageId}], and GET, POST,
+PUT and DELETE on /concepts[/{id}] and /edges[/{id}]. Listings take limit and
+cursor parameters and return the cursor of the next page as nextCursor.
+
+GET /events streams each processed message, and every concept and edge
+change, as Server-Sent Events; add ?session=<id> to follow only some sessions.
+A client reconnecting with Last-Event-ID receives the events it missed.
+
+GET /live is a WebSocket carrying the same events, over which a client can
+also send chat messages and curation commands (concept.rename, concept.merge,
+edge.delete) and receives an acknowledgement for each. Browser pages from
+other sites are refused unless listed with --allow-origin.
+
+A web viewer at /ui/ draws the concept graph and a timeline of messages and
+follows /events to keep them current; GET /graph returns what it loads.
+GET /export/{format} returns the graph in the shapes of enkente export.`,
 	Run: func(cmd *cobra.Command, args []string) {
+		// The server closes the datastore on shutdown, once the workers
+		// writing to it have drained.
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("Failed to open datastore: %v", err)
+		}
+
 		p := tea.NewProgram(
 			initialServeModel(servePort),
 			tea.WithAltScreen(),
 			tea.WithMouseCellMotion(),
 		)
 
-		handler := func(workerID int, msg parser.AntigravityMessage) {
+		handler := messageHandler(store, func(workerID int, msg parser.AntigravityMessage) error {
 			p.Send(serveMsg{workerID: workerID, msg: msg})
+			return nil
+		})
+
+		opts := []api.Option{
+			api.WithQueueDepth(serveQueueDepth),
+			api.WithEnqueueTimeout(serveEnqueueTimeout),
+			api.WithRetries(serveRetries+1, 100*time.Millisecond),
+			api.WithIdempotencyTTL(serveDedupTTL),
+			api.WithAllowedOrigins(serveAllowedOrigins...),
+			api.WithFailureHandler(func(workerID int, msg parser.AntigravityMessage, err error, attempts int) {
+				if store != nil {
+					err = deadLetter(store, sourceAPI, workerID, msg, err, attempts)
+				}
+				p.Send(serveMsg{workerID: workerID, msg: msg, saveErr: err})
+			}),
 		}
+		if serveOrdered {
+			opts = append(opts, api.WithOrderedDelivery())
+		}
+		if store != nil {
+			opts = append(opts, api.WithStore(store))
+		}
+		server := api.NewServer(servePort, 4, handler, opts...)
 
-		server := api.NewServer(servePort, 4, handler)
+		// SIGINT and SIGTERM quit the TUI just like q does, and either way
+		// the server is shut down gracefully below.
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		go func() {
+			<-ctx.Done()
+			p.Quit()
+		}()
+		go reportStats(ctx, p, server.Stats)
+		if store != nil {
+			go pruneStore(ctx, store, time.Hour, serveEventRetention)
+		}
 
+		serverErr := make(chan error, 1)
 		go func() {
-			if err := server.Start(); err != nil {
-				log.Fatalf("Server error: %v", err)
+			err := server.Start()
+			if err != nil {
+				p.Quit()
 			}
+			serverErr <- err
 		}()
 
-		if _, err := p.Run(); err != nil {
-			log.Fatalf("TUI error: %v", err)
+		_, runErr := p.Run()
+		stop()
+
+		fmt.Printf("Shutting down, draining %d queued messages...\n", server.Queued())
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), serveShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Shutdown incomplete: %v", err)
+		}
+
+		select {
+		case err := <-serverErr:
+			if err != nil {
+				log.Fatalf("Server error: %v", err)
+			}
+		default:
+		}
+		if runErr != nil {
+			log.Fatalf("TUI error: %v", runErr)
 		}
 	},
 }
@@ -53,6 +158,14 @@ Send messages with:
 func init() {
 	rootCmd.AddCommand(serveCmd)
 	serveCmd.Flags().IntVarP(&servePort, "port", "p", 8080, "Port to listen on")
+	serveCmd.Flags().BoolVar(&serveOrdered, "ordered", false, "Handle each session's messages in order by pinning sessions to workers")
+	serveCmd.Flags().IntVar(&serveRetries, "retries", 2, "How many times to retry a message that could not be saved")
+	serveCmd.Flags().IntVar(&serveQueueDepth, "queue-depth", 100, "How many messages may wait for a worker before requests are turned away")
+	serveCmd.Flags().DurationVar(&serveEnqueueTimeout, "enqueue-timeout", 2*time.Second, "How long a request waits for room in a full queue before getting 429")
+	serveCmd.Flags().DurationVar(&serveDedupTTL, "dedup-ttl", parser.DefaultDedupTTL, "How long idempotency keys are remembered")
+	serveCmd.Flags().StringSliceVar(&serveAllowedOrigins, "allow-origin", nil, "Browser origin, such as https://example.com, allowed to open /live (repeatable)")
+	serveCmd.Flags().DurationVar(&serveEventRetention, "event-retention", 24*time.Hour, "How long events are kept for clients resuming /events")
+	serveCmd.Flags().DurationVar(&serveShutdownTimeout, "shutdown-timeout", 10*time.Second, "How long to wait for queued messages to drain on exit")
 }
 
 // Bubble Tea model for the serve command
@@ -60,6 +173,7 @@ func init() {
 type serveMsg struct {
 	workerID int
 	msg      parser.AntigravityMessage
+	saveErr  error
 }
 
 type serveModel struct {
@@ -68,6 +182,7 @@ type serveModel struct {
 	viewport viewport.Model
 	port     int
 	msgCount int
+	stats    []pipeline.WorkerStats
 }
 
 func initialServeModel(port int) serveModel {
@@ -104,6 +219,9 @@ func (m serveModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.viewport.Height = msg.Height - verticalMarginHeight
 		}
 
+	case statsMsg:
+		m.stats = msg
+
 	case serveMsg:
 		m.msgCount++
 
@@ -112,23 +230,7 @@ func (m serveModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		colorCount := lipgloss.Color("5")  // Magenta
 
 		// Wes Anderson palette for user colors
-		userPalette := theme.AllUserColors()
-
-		var senderColor lipgloss.Color
-		if msg.msg.Type == "system" {
-			senderColor = theme.SystemColor
-		} else {
-			// Hash the user identity to a stable palette index
-			identity := msg.msg.User
-			if identity == "" {
-				identity = msg.msg.Type
-			}
-			hash := uint(0)
-			for _, c := range identity {
-				hash = hash*31 + uint(c)
-			}
-			senderColor = userPalette[hash%uint(len(userPalette))]
-		}
+		senderColor := theme.UserColor(msg.msg.User, msg.msg.Type)
 
 		timeStr := lipgloss.NewStyle().Foreground(colorTime).Render("[" + msg.msg.Timestamp.Format(time.TimeOnly) + "]")
 		workerStr := lipgloss.NewStyle().Foreground(colorWorker).Bold(true).Render(fmt.Sprintf("[W%d]", msg.workerID))
@@ -141,7 +243,7 @@ func (m serveModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		typeStr := lipgloss.NewStyle().Foreground(senderColor).Bold(true).Render(sender)
 		msgStr := lipgloss.NewStyle().Foreground(senderColor).Render(msg.msg.Message)
 
-		newLine := fmt.Sprintf("%s %s %s %s: %s\n", timeStr, workerStr, countStr, typeStr, msgStr)
+		newLine := fmt.Sprintf("%s %s %s %s: %s%s\n", timeStr, workerStr, countStr, typeStr, msgStr, saveErrView(msg.saveErr))
 		m.content += newLine
 		m.viewport.SetContent(m.content)
 		m.viewport.GotoBottom()
@@ -170,6 +272,7 @@ func (m serveModel) headerView() string {
 func (m serveModel) footerView() string {
 	info := infoStyle.Render(fmt.Sprintf("%3.f%%", m.viewport.ScrollPercent()*100))
 	hint := lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render(" q/esc to quit • scroll with mouse/arrows ")
-	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(info)-lipgloss.Width(hint)))
-	return lipgloss.JoinHorizontal(lipgloss.Center, hint, line, info)
+	stats := statsView(m.stats)
+	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(info)-lipgloss.Width(hint)-lipgloss.Width(stats)))
+	return lipgloss.JoinHorizontal(lipgloss.Center, hint, stats, line, info)
 }
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -10,10 +13,19 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
 	"github.com/spf13/cobra"
 )
 
-var logFile string
+var (
+	logFile   string
+	logFormat string
+	replayLog bool
+	watchMode string
+	ordered   bool
+	retries   int
+	dedupTTL  time.Duration
+)
 
 var tailCmd = &cobra.Command{
 	Use:   "tail",
@@ -23,19 +35,79 @@ var tailCmd = &cobra.Command{
 			log.Fatal("Please provide a path to the live logs.json using --log")
 		}
 
+		store, err := openStore()
+		if err != nil {
+			log.Fatalf("Failed to open datastore: %v", err)
+		}
+		if store != nil {
+			defer store.Close()
+		}
+
 		p := tea.NewProgram(
 			initialModel(),
 			tea.WithAltScreen(),
 			tea.WithMouseCellMotion(),
 		)
 
-		done := make(chan struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
 
-		handler := func(workerID int, msg parser.AntigravityMessage) {
+		handler := messageHandler(store, func(workerID int, msg parser.AntigravityMessage) error {
 			p.Send(tailMsg{workerID: workerID, msg: msg})
+			return nil
+		})
+		cfg := pipeline.Config[parser.AntigravityMessage]{
+			Workers:     4,
+			MaxAttempts: retries + 1,
+			Backoff:     100 * time.Millisecond,
+			MaxBackoff:  2 * time.Second,
+			OnFailure: func(workerID int, msg parser.AntigravityMessage, err error, attempts int) {
+				if store != nil {
+					err = deadLetter(store, sourceTail, workerID, msg, err, attempts)
+				}
+				p.Send(tailMsg{workerID: workerID, msg: msg, saveErr: err})
+			},
+		}
+		if ordered {
+			cfg.Key = parser.SessionKey
+		}
+		pool := pipeline.New(ctx, cfg, handler)
+		defer pool.Close()
+		go reportStats(ctx, p, pool.Stats)
+
+		format := parser.LogFormat(logFormat)
+		if format != "" && format != parser.FormatJSON && format != parser.FormatNDJSON {
+			log.Fatalf("Unknown log format %q (want json or ndjson)", logFormat)
+		}
+
+		watch, err := parser.ParseWatchMode(watchMode)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		opts := parser.TailOptions{
+			Format: format,
+			Watch:  watch,
+			Replay: replayLog,
+		}
+		if store != nil {
+			opts.Checkpoints = store
+			opts.Dedup = store
+			opts.DedupTTL = dedupTTL
+			go pruneStore(ctx, store, time.Hour, 0)
+		}
+		opts.OnError = func(path string, err error) {
+			p.Send(tailErrMsg{path: path, err: err})
 		}
 
-		err := parser.TailChatLog(logFile, 500*time.Millisecond, 4, handler, done)
+		// A directory or glob tails every conversation log it matches, each
+		// file being one session.
+		if isLogSet(logFile) {
+			opts.SessionFromFileName = true
+			err = parser.TailGlob(ctx, logFile, opts, pool)
+		} else {
+			err = parser.Tail(ctx, logFile, opts, pool)
+		}
 		if err != nil {
 			log.Fatalf("Failed to start tailer: %v", err)
 		}
@@ -48,7 +120,13 @@ var tailCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(tailCmd)
-	tailCmd.Flags().StringVarP(&logFile, "log", "l", "", "Path to the live logs.json to tail")
+	tailCmd.Flags().StringVarP(&logFile, "log", "l", "", "Path to the live logs.json to tail, or a directory or glob of logs")
+	tailCmd.Flags().StringVarP(&logFormat, "format", "f", "", "Log format: json or ndjson (default: detect from extension)")
+	tailCmd.Flags().BoolVar(&replayLog, "replay", false, "Ignore the saved checkpoint and replay the whole log")
+	tailCmd.Flags().StringVar(&watchMode, "watch", "auto", "How to detect log changes: auto, poll or notify")
+	tailCmd.Flags().BoolVar(&ordered, "ordered", false, "Handle each session's messages in order by pinning sessions to workers")
+	tailCmd.Flags().IntVar(&retries, "retries", 2, "How many times to retry a message that could not be saved")
+	tailCmd.Flags().DurationVar(&dedupTTL, "dedup-ttl", parser.DefaultDedupTTL, "How long to remember messages so a rewritten log does not emit them again")
 	tailCmd.MarkFlagRequired("log")
 }
 
@@ -71,12 +149,57 @@ var (
 type tailMsg struct {
 	workerID int
 	msg      parser.AntigravityMessage
+	saveErr  error
+}
+
+type tailErrMsg struct {
+	path string
+	err  error
+}
+
+// statsMsg carries a periodic snapshot of the worker pool's throughput.
+type statsMsg []pipeline.WorkerStats
+
+// reportStats sends worker stats to the TUI every second until ctx is done.
+func reportStats(ctx context.Context, p *tea.Program, stats func() []pipeline.WorkerStats) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.Send(statsMsg(stats()))
+		}
+	}
+}
+
+// statsView renders per-worker throughput, e.g. "W0 12.5/s W1 3.0/s".
+func statsView(stats []pipeline.WorkerStats) string {
+	parts := make([]string, len(stats))
+	for i, st := range stats {
+		parts[i] = fmt.Sprintf("W%d %.1f/s", st.WorkerID, st.PerSecond)
+		if st.Failed > 0 {
+			parts[i] += fmt.Sprintf(" (%d failed)", st.Failed)
+		}
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("240")).Render(strings.Join(parts, "  "))
+}
+
+// isLogSet reports whether the --log argument names a directory or a glob
+// pattern rather than a single file.
+func isLogSet(arg string) bool {
+	if info, err := os.Stat(arg); err == nil {
+		return info.IsDir()
+	}
+	return strings.ContainsAny(arg, "*?[")
 }
 
 type model struct {
 	content  string
 	ready    bool
 	viewport viewport.Model
+	stats    []pipeline.WorkerStats
 }
 
 func initialModel() model {
@@ -128,10 +251,19 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		workerStr := lipgloss.NewStyle().Foreground(colorWorker).Render(fmt.Sprintf("[Worker-%d]", msg.workerID))
 		msgStr := lipgloss.NewStyle().Foreground(typeColor).Render(fmt.Sprintf("%s: %s", msg.msg.Type, msg.msg.Message))
 
-		newLine := fmt.Sprintf("%s %s %s\n", timeStr, workerStr, msgStr)
+		newLine := fmt.Sprintf("%s %s %s%s\n", timeStr, workerStr, msgStr, saveErrView(msg.saveErr))
 		m.content += newLine
 		m.viewport.SetContent(m.content)
 		m.viewport.GotoBottom()
+
+	case statsMsg:
+		m.stats = msg
+
+	case tailErrMsg:
+		errStr := lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(fmt.Sprintf("[%s] %v", filepath.Base(msg.path), msg.err))
+		m.content += errStr + "\n"
+		m.viewport.SetContent(m.content)
+		m.viewport.GotoBottom()
 	}
 
 	m.viewport, cmd = m.viewport.Update(msg)
@@ -149,8 +281,9 @@ func (m model) View() string {
 
 func (m model) headerView() string {
 	title := titleStyle.Render("enkente Live Worker Swarm")
-	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(title)))
-	return lipgloss.JoinHorizontal(lipgloss.Center, title, line)
+	stats := statsView(m.stats)
+	line := strings.Repeat("─", max(0, m.viewport.Width-lipgloss.Width(title)-lipgloss.Width(stats)))
+	return lipgloss.JoinHorizontal(lipgloss.Center, title, line, stats)
 }
 
 func (m model) footerView() string {
@@ -159,6 +292,14 @@ func (m model) footerView() string {
 	return lipgloss.JoinHorizontal(lipgloss.Center, line, info)
 }
 
+// saveErrView renders a persistence failure as a suffix on the message line.
+func saveErrView(err error) string {
+	if err == nil {
+		return ""
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Render(fmt.Sprintf(" (not saved: %v)", err))
+}
+
 func max(a, b int) int {
 	if a > b {
 		return a
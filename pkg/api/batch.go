@@ -0,0 +1,206 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+)
+
+const (
+	// maxBatchBytes caps the size of a batch request body.
+	maxBatchBytes = 32 << 20
+	// maxBatchItems caps the number of messages in one batch.
+	maxBatchItems = 10000
+)
+
+// BatchItemResult reports what happened to one message of a batch.
+type BatchItemResult struct {
+	Index     int    `json:"index"`
+	Status    string `json:"status"` // "accepted" or "rejected"
+	SessionID string `json:"sessionId,omitempty"`
+	MessageID *int   `json:"messageId,omitempty"`
+	// Replayed marks an item whose client message id was already accepted;
+	// the ids are those of the original.
+	Replayed bool   `json:"replayed,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchResponse is the body returned by /ingest/batch.
+type BatchResponse struct {
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Results  []BatchItemResult `json:"results"`
+	// Error explains why the batch stopped early, if it did, and Code
+	// classifies it as in ErrorResponse.
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// handleIngestBatch accepts many messages in one request, either as a JSON
+// array of IngestRequest or as NDJSON with one IngestRequest per line. Each
+// item is validated and queued on its own, so one bad item does not sink the
+// rest; the response lists the outcome of every item in order.
+//
+// The response is 202 once every item has been looked at. If the queue fills
+// up or the server starts shutting down, the remaining items are rejected
+// and the response carries the matching 429 or 503 status and Retry-After,
+// so the client can resend just the items that were not accepted. Items are
+// deduplicated by client message id as on /ingest, so resending the whole
+// batch is safe too. A JSON
+// array that is malformed part-way through ends the batch with 400.
+func (s *Server) handleIngestBatch(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxBatchBytes))
+	resp := BatchResponse{Results: []BatchItemResult{}}
+	status := http.StatusAccepted
+
+	// stopped is set once the queue refuses messages; every later item is
+	// rejected without trying.
+	var stopped error
+	add := func(req IngestRequest, decodeErr error) error {
+		i := len(resp.Results)
+		if i >= maxBatchItems {
+			return fmt.Errorf("batch has more than %d items", maxBatchItems)
+		}
+		result := BatchItemResult{Index: i}
+		err := decodeErr
+		if err == nil {
+			err = stopped
+		}
+		if err == nil {
+			var accepted IngestResponse
+			accepted, err = s.accept(r.Context(), req, "")
+			if err == nil {
+				result.Status = accepted.Status
+				result.SessionID = accepted.SessionID
+				result.MessageID = &accepted.MessageID
+				result.Replayed = accepted.Replayed
+			} else if code := ingestStatus(err); code != http.StatusBadRequest {
+				stopped, status = err, code
+			}
+		}
+		if err != nil {
+			result.Status = "rejected"
+			result.SessionID = req.SessionID
+			result.Error = err.Error()
+			resp.Rejected++
+		} else {
+			resp.Accepted++
+		}
+		resp.Results = append(resp.Results, result)
+		return nil
+	}
+
+	var err error
+	if isNDJSON(r.Header.Get("Content-Type"), body) {
+		err = decodeNDJSONBatch(body, add)
+	} else {
+		err = decodeArrayBatch(body, add)
+	}
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			status = http.StatusRequestEntityTooLarge
+		} else {
+			status = http.StatusBadRequest
+		}
+		resp.Error = err.Error()
+	}
+
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		s.setRetryAfter(w)
+	}
+	if status != http.StatusAccepted {
+		resp.Code = errorCodes[status]
+	}
+	writeJSON(w, status, resp)
+}
+
+// isNDJSON decides how to read a batch: by Content-Type if it names NDJSON,
+// otherwise by whether the body starts with '[' for a JSON array.
+func isNDJSON(contentType string, body *bufio.Reader) bool {
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		switch mt {
+		case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+			return true
+		}
+	}
+	for {
+		b, err := body.Peek(1)
+		if err != nil {
+			return false
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			body.ReadByte()
+		default:
+			return b[0] != '['
+		}
+	}
+}
+
+// decodeArrayBatch streams the elements of a JSON array to add. An element
+// of the wrong shape is passed on as a per-item error; malformed JSON ends
+// the batch since nothing after it can be trusted.
+func decodeArrayBatch(r io.Reader, add func(IngestRequest, error) error) error {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("read batch: %w", err)
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return errors.New("expected a JSON array or NDJSON")
+	}
+
+	for i := 0; dec.More(); i++ {
+		var req IngestRequest
+		err := dec.Decode(&req)
+		if err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+			err = fmt.Errorf("%w: %v", errInvalid, err)
+		}
+		if err := add(req, err); err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("read batch: %w", err)
+	}
+	return nil
+}
+
+// decodeNDJSONBatch passes each non-blank line to add. Lines are independent,
+// so a malformed one is only that item's error.
+func decodeNDJSONBatch(r io.Reader, add func(IngestRequest, error) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), parser.MaxNDJSONLine)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var req IngestRequest
+		err := json.Unmarshal(line, &req)
+		if err != nil {
+			err = fmt.Errorf("%w: %v", errInvalid, err)
+		}
+		if err := add(req, err); err != nil {
+			return err
+		}
+	}
+	if errors.Is(scanner.Err(), bufio.ErrTooLong) {
+		return fmt.Errorf("read batch: a line is longer than %d bytes", parser.MaxNDJSONLine)
+	}
+	return scanner.Err()
+}
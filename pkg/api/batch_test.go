@@ -0,0 +1,137 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+)
+
+var _ = Describe("Batch Ingestion", func() {
+	var (
+		server  *api.Server
+		handled atomic.Int32
+	)
+
+	BeforeEach(func() {
+		handled.Store(0)
+		handler := func(_ context.Context, _ int, _ parser.AntigravityMessage) error {
+			handled.Add(1)
+			return nil
+		}
+		server = api.NewServer(0, 2, handler)
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	post := func(contentType, body string) (int, api.BatchResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/ingest/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		var resp api.BatchResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed(), rec.Body.String())
+		return rec.Code, resp
+	}
+
+	statuses := func(resp api.BatchResponse) []string {
+		out := make([]string, len(resp.Results))
+		for i, r := range resp.Results {
+			out[i] = r.Status
+		}
+		return out
+	}
+
+	It("accepts a JSON array and reports each item", func() {
+		code, resp := post("application/json", `[
+			{"sessionId":"s","type":"user","message":"one"},
+			{"sessionId":"s","message":"no type"},
+			{"sessionId":"s","type":"user","message":"two"},
+			{"sessionId":"s","type":42}
+		]`)
+		Expect(code).To(Equal(http.StatusAccepted))
+		Expect(resp.Accepted).To(Equal(2))
+		Expect(resp.Rejected).To(Equal(2))
+		Expect(statuses(resp)).To(Equal([]string{"accepted", "rejected", "accepted", "rejected"}))
+		Expect(*resp.Results[0].MessageID).To(Equal(0))
+		Expect(*resp.Results[2].MessageID).To(Equal(1))
+		Expect(resp.Results[1].Error).To(ContainSubstring("type is required"))
+
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		Expect(handled.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("accepts NDJSON, skipping blank lines and rejecting malformed ones", func() {
+		body := `{"sessionId":"n","type":"user","message":"a"}` + "\n\n" +
+			`{not json}` + "\n" +
+			`{"sessionId":"n","type":"user","message":"b"}` + "\n"
+		code, resp := post("application/x-ndjson", body)
+		Expect(code).To(Equal(http.StatusAccepted))
+		Expect(statuses(resp)).To(Equal([]string{"accepted", "rejected", "accepted"}))
+		Expect(*resp.Results[2].MessageID).To(Equal(1))
+	})
+
+	It("detects NDJSON from the body when the content type is generic", func() {
+		code, resp := post("text/plain", `{"type":"user","message":"a"}`+"\n"+`{"type":"user","message":"b"}`)
+		Expect(code).To(Equal(http.StatusAccepted))
+		Expect(resp.Accepted).To(Equal(2))
+	})
+
+	It("stops at malformed JSON in an array but keeps what came before", func() {
+		code, resp := post("application/json", `[{"type":"user","message":"ok"}, {"type": ]`)
+		Expect(code).To(Equal(http.StatusBadRequest))
+		Expect(resp.Accepted).To(Equal(1))
+		Expect(resp.Error).To(ContainSubstring("item 1"))
+	})
+
+	It("accepts NDJSON lines as long as the tailer does", func() {
+		long := `{"type":"user","message":"` + strings.Repeat("x", 2<<20) + `"}` + "\n"
+		code, resp := post("application/x-ndjson", long)
+		Expect(code).To(Equal(http.StatusAccepted))
+		Expect(resp.Accepted).To(Equal(1))
+	})
+
+	It("rejects the rest of the batch with 429 once the queue is full", func() {
+		release := make(chan struct{})
+		blocked := func(ctx context.Context, _ int, _ parser.AntigravityMessage) error {
+			select {
+			case <-ctx.Done():
+			case <-release:
+			}
+			return nil
+		}
+		full := api.NewServer(0, 1, blocked, api.WithQueueDepth(1), api.WithEnqueueTimeout(10*time.Millisecond))
+		defer func() {
+			close(release)
+			Expect(full.Shutdown(context.Background())).To(Succeed())
+		}()
+
+		req := httptest.NewRequest(http.MethodPost, "/ingest/batch",
+			strings.NewReader(strings.Repeat(`{"type":"user","message":"x"}`+"\n", 5)))
+		rec := httptest.NewRecorder()
+		full.Handler().ServeHTTP(rec, req)
+
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).NotTo(BeEmpty())
+		var resp api.BatchResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Results).To(HaveLen(5))
+		// The worker holds one and the queue one; whatever did not fit was
+		// turned away.
+		Expect(resp.Accepted).To(BeNumerically(">=", 1))
+		Expect(resp.Accepted).To(BeNumerically("<=", 2))
+		Expect(resp.Results[4].Status).To(Equal("rejected"))
+	})
+})
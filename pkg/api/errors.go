@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Error codes carried in ErrorResponse, one per kind of failure.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeTooLarge         = "too_large"
+	CodeQueueFull        = "queue_full"
+	CodeUnavailable      = "unavailable"
+	CodeInternal         = "internal"
+)
+
+// ErrorResponse is the body of every error the API returns.
+type ErrorResponse struct {
+	// Error describes what went wrong, for people.
+	Error string `json:"error"`
+	// Code classifies the error, for programs.
+	Code string `json:"code"`
+}
+
+// errorCodes maps HTTP statuses to the code reported with them.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeConflict,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusRequestEntityTooLarge: CodeTooLarge,
+	http.StatusTooManyRequests:       CodeQueueFull,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// writeJSON writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers with an ErrorResponse whose code follows from status.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	code, ok := errorCodes[status]
+	if !ok {
+		code = CodeInternal
+	}
+	writeJSON(w, status, ErrorResponse{Error: msg, Code: code})
+}
+
+// jsonErrors answers the requests mux has no route for with an ErrorResponse,
+// rather than the mux's plain-text 404 and 405.
+func jsonErrors(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, pattern := mux.Handler(r); pattern != "" {
+			mux.ServeHTTP(w, r)
+			return
+		}
+		rec := &statusRecorder{header: w.Header()}
+		mux.ServeHTTP(rec, r)
+		switch rec.status {
+		case http.StatusMethodNotAllowed:
+			writeError(w, rec.status, "Method not allowed")
+		default:
+			writeError(w, http.StatusNotFound, "Not found")
+		}
+	})
+}
+
+// statusRecorder keeps the status and headers a handler writes and discards
+// its body.
+type statusRecorder struct {
+	header http.Header
+	status int
+}
+
+func (r *statusRecorder) Header() http.Header { return r.header }
+
+func (r *statusRecorder) WriteHeader(status int) { r.status = status }
+
+func (r *statusRecorder) Write(b []byte) (int, error) { return len(b), nil }
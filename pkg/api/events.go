@@ -0,0 +1,368 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// Event types sent on /events and /live.
+const (
+	EventMessage        = "message"
+	EventConceptCreated = "concept.created"
+	EventConceptUpdated = "concept.updated"
+	EventConceptDeleted = "concept.deleted"
+	// EventConceptMerged carries a storage.MergeResult.
+	EventConceptMerged = "concept.merged"
+	EventEdgeCreated   = "edge.created"
+	EventEdgeUpdated   = "edge.updated"
+	EventEdgeDeleted   = "edge.deleted"
+)
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind by
+	// before it is dropped.
+	subscriberBuffer = 256
+	// keepAliveInterval is how often an idle stream sends a comment, so
+	// proxies do not close it.
+	keepAliveInterval = 15 * time.Second
+	// streamWriteTimeout bounds one write to a subscriber's connection.
+	streamWriteTimeout = 10 * time.Second
+	// replayPage is how many stored events are read at a time when a
+	// subscriber resumes.
+	replayPage = 500
+	// publishBuffer is how many published events may wait to be stored
+	// before publish blocks.
+	publishBuffer = 4096
+	// publishBatch caps how many waiting events are stored in one
+	// transaction.
+	publishBatch = 256
+)
+
+// hub fans events out to the subscribers of /events. Publishing never
+// waits on the datastore: events are queued for one goroutine that stores
+// them in batches, numbering them in order, and then sends them on. A
+// subscriber whose buffer is full is dropped, and can reconnect with
+// Last-Event-ID to catch up from the datastore.
+type hub struct {
+	store *storage.BoltStorage
+	queue chan storage.Event
+	// stopMu guards stopped against publishers, which hold it shared while
+	// queueing.
+	stopMu  sync.RWMutex
+	stopped bool
+	// done is closed once every queued event has been stored and sent.
+	done chan struct{}
+	// seq numbers events when there is no datastore to do it. Only the
+	// run goroutine uses it.
+	seq uint64
+
+	mu     sync.Mutex
+	subs   map[*subscriber]struct{}
+	closed bool
+}
+
+type subscriber struct {
+	events chan storage.Event
+	// sessions limits the subscriber to events of these sessions; nil
+	// means every event.
+	sessions map[string]bool
+	// lagged is set, before events is closed, if the subscriber was
+	// dropped for falling behind.
+	lagged bool
+}
+
+func newHub(store *storage.BoltStorage) *hub {
+	h := &hub{
+		store: store,
+		queue: make(chan storage.Event, publishBuffer),
+		done:  make(chan struct{}),
+		subs:  map[*subscriber]struct{}{},
+	}
+	go h.run()
+	return h
+}
+
+func (sub *subscriber) wants(ev storage.Event) bool {
+	return sub.sessions == nil || sub.sessions[ev.SessionID]
+}
+
+// RecordMessage stores the event a server publishes once it has processed
+// msg, for messages processed outside any server, such as re-driven dead
+// letters. Subscribers receive it when they catch up with Last-Event-ID.
+func RecordMessage(store *storage.BoltStorage, msg parser.AntigravityMessage) error {
+	ev, err := newEvent(EventMessage, msg.SessionID, msg)
+	if err != nil {
+		return err
+	}
+	return store.AppendEvent(&ev)
+}
+
+// newEvent builds an event of type typ with v as its data.
+func newEvent(typ, sessionID string, v any) (storage.Event, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return storage.Event{}, err
+	}
+	return storage.Event{Type: typ, SessionID: sessionID, Data: data, At: time.Now().UTC()}, nil
+}
+
+// publish queues an event with v as its data, to be stored and sent to every
+// interested subscriber in the order published. Events published once the
+// hub has stopped are dropped.
+func (h *hub) publish(typ, sessionID string, v any) {
+	ev, err := newEvent(typ, sessionID, v)
+	if err != nil {
+		return
+	}
+	h.stopMu.RLock()
+	defer h.stopMu.RUnlock()
+	if !h.stopped {
+		h.queue <- ev
+	}
+}
+
+// run stores and sends the queued events until the queue is closed, taking
+// whatever has piled up into each batch.
+func (h *hub) run() {
+	defer close(h.done)
+	for ev := range h.queue {
+		batch := []storage.Event{ev}
+	fill:
+		for len(batch) < publishBatch {
+			select {
+			case ev, ok := <-h.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, ev)
+			default:
+				break fill
+			}
+		}
+		h.record(batch)
+		h.fanOut(batch)
+	}
+}
+
+// record numbers the events of batch, storing them if there is a datastore.
+// Events that could not be stored are still sent, without an id.
+func (h *hub) record(batch []storage.Event) {
+	if h.store == nil {
+		for i := range batch {
+			h.seq++
+			batch[i].ID = h.seq
+		}
+		return
+	}
+	if err := h.store.AppendEvents(batch); err != nil {
+		for i := range batch {
+			batch[i].ID = 0
+		}
+	}
+}
+
+// fanOut sends each event of batch to the subscribers that want it.
+func (h *hub) fanOut(batch []storage.Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ev := range batch {
+		for sub := range h.subs {
+			if !sub.wants(ev) {
+				continue
+			}
+			select {
+			case sub.events <- ev:
+			default:
+				sub.lagged = true
+				delete(h.subs, sub)
+				close(sub.events)
+			}
+		}
+	}
+}
+
+// subscribe registers a subscriber for the given sessions, or for all events
+// if sessions is empty. Once the hub is closed the subscriber's channel is
+// closed straight away.
+func (h *hub) subscribe(sessions []string) *subscriber {
+	sub := &subscriber{events: make(chan storage.Event, subscriberBuffer)}
+	if len(sessions) > 0 {
+		sub.sessions = map[string]bool{}
+		for _, s := range sessions {
+			sub.sessions[s] = true
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(sub.events)
+		return sub
+	}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *hub) unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// stop stores and sends the events already published and drops any
+// published later. It returns once they are done, so the datastore can be
+// closed.
+func (h *hub) stop() {
+	h.stopMu.Lock()
+	if !h.stopped {
+		h.stopped = true
+		close(h.queue)
+	}
+	h.stopMu.Unlock()
+	<-h.done
+}
+
+// close ends every subscription and refuses new ones.
+func (h *hub) close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for sub := range h.subs {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+// handleEvents streams events as Server-Sent Events. Repeating the session
+// query parameter limits the stream to those sessions. A client that sends
+// Last-Event-ID, or the lastEventId query parameter, first gets the stored
+// events it missed.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	lastID, err := lastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	sub := s.events.subscribe(r.URL.Query()["session"])
+	defer s.events.unsubscribe(sub)
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	// send writes one chunk of the stream, giving up on a client that does
+	// not take it in time.
+	send := func(chunk string) bool {
+		rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout))
+		if _, err := fmt.Fprint(w, chunk); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+	if !send(": connected\n\n") {
+		return
+	}
+
+	lastID, err = s.replay(sub, lastID, func(ev storage.Event) bool { return send(formatEvent(ev)) })
+	if err != nil {
+		if !errors.Is(err, errStreamClosed) {
+			send("event: error\ndata: {\"error\":\"could not read stored events\",\"code\":\"internal\"}\n\n")
+		}
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-keepAlive.C:
+			if !send(": keep-alive\n\n") {
+				return
+			}
+		case ev, ok := <-sub.events:
+			if !ok {
+				if sub.lagged {
+					send(": too far behind, reconnect with Last-Event-ID to catch up\n\n")
+				}
+				return
+			}
+			if ev.ID != 0 && ev.ID <= lastID {
+				continue
+			}
+			if !send(formatEvent(ev)) {
+				return
+			}
+		}
+	}
+}
+
+// lastEventID reads the id a client resumes after, from the Last-Event-ID
+// header or the lastEventId query parameter, which is how a client that
+// cannot set headers passes it. It is 0 if the client is not resuming.
+func lastEventID(r *http.Request) (uint64, error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("lastEventId")
+	}
+	if v == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Last-Event-ID %q", v)
+	}
+	return id, nil
+}
+
+// errStreamClosed means a subscriber's connection went away mid-replay.
+var errStreamClosed = errors.New("stream closed")
+
+// replay sends sub the stored events after lastID that it wants, and returns
+// the id of the last stored event, so that the same events arriving on
+// sub's channel can be skipped. Anything published since sub subscribed is
+// in both places. send returning false stops the replay with
+// errStreamClosed.
+func (s *Server) replay(sub *subscriber, lastID uint64, send func(storage.Event) bool) (uint64, error) {
+	if lastID == 0 || s.store == nil {
+		return lastID, nil
+	}
+	for {
+		stored, err := s.store.EventsAfter(lastID, replayPage)
+		if err != nil {
+			return lastID, err
+		}
+		for _, ev := range stored {
+			lastID = ev.ID
+			if sub.wants(ev) && !send(ev) {
+				return lastID, errStreamClosed
+			}
+		}
+		if len(stored) < replayPage {
+			return lastID, nil
+		}
+	}
+}
+
+// formatEvent renders ev in the text/event-stream format.
+func formatEvent(ev storage.Event) string {
+	id := ""
+	if ev.ID != 0 {
+		id = fmt.Sprintf("id: %d\n", ev.ID)
+	}
+	return fmt.Sprintf("%sevent: %s\ndata: %s\n\n", id, ev.Type, ev.Data)
+}
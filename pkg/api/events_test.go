@@ -0,0 +1,171 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// sseEvent is one event read off a text/event-stream.
+type sseEvent struct {
+	ID, Type string
+	Message  parser.AntigravityMessage
+}
+
+var _ = Describe("Event Stream", func() {
+	var (
+		server *api.Server
+		ts     *httptest.Server
+		store  *storage.BoltStorage
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "events.db"))
+		Expect(err).NotTo(HaveOccurred())
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 2, handler, api.WithStore(store), api.WithOrderedDelivery())
+		ts = httptest.NewServer(server.Handler())
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		ts.Close()
+	})
+
+	// subscribe opens the event stream and returns its events as they arrive.
+	subscribe := func(query, lastEventID string) <-chan sseEvent {
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL+"/events"+query, nil)
+		Expect(err).NotTo(HaveOccurred())
+		if lastEventID != "" {
+			req.Header.Set("Last-Event-ID", lastEventID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		Expect(resp.Header.Get("Content-Type")).To(Equal("text/event-stream"))
+
+		events := make(chan sseEvent, 100)
+		go func() {
+			defer GinkgoRecover()
+			defer resp.Body.Close()
+			scanner := bufio.NewScanner(resp.Body)
+			var ev sseEvent
+			for scanner.Scan() {
+				line := scanner.Text()
+				switch {
+				case strings.HasPrefix(line, "id: "):
+					ev.ID = strings.TrimPrefix(line, "id: ")
+				case strings.HasPrefix(line, "event: "):
+					ev.Type = strings.TrimPrefix(line, "event: ")
+				case strings.HasPrefix(line, "data: "):
+					json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &ev.Message)
+				case line == "" && ev.Type != "":
+					events <- ev
+					ev = sseEvent{}
+				}
+			}
+		}()
+		return events
+	}
+
+	send := func(session, text string) {
+		body := `{"sessionId":"` + session + `","type":"user","message":"` + text + `"}`
+		Expect(ingest(server, body).Code).To(Equal(http.StatusAccepted))
+	}
+
+	It("broadcasts processed messages to every subscriber", func() {
+		all := subscribe("", "")
+		onlyA := subscribe("?session=a", "")
+
+		send("a", "one")
+		send("b", "two")
+		send("a", "three")
+
+		var (
+			ev   sseEvent
+			seen []string
+		)
+		for range 3 {
+			Eventually(all).Should(Receive(&ev))
+			Expect(ev.Type).To(Equal(api.EventMessage))
+			seen = append(seen, ev.Message.Message)
+		}
+		Expect(seen).To(ConsistOf("one", "two", "three"))
+		Eventually(onlyA).Should(Receive(&ev))
+		Expect(ev.Message.SessionID).To(Equal("a"))
+		Eventually(onlyA).Should(Receive(&ev))
+		Expect(ev.Message.Message).To(Equal("three"))
+		Consistently(onlyA, "100ms").ShouldNot(Receive())
+	})
+
+	It("resumes after Last-Event-ID from the datastore", func() {
+		first := subscribe("", "")
+		send("s", "one")
+		send("s", "two")
+
+		var ev sseEvent
+		Eventually(first).Should(Receive(&ev))
+		Expect(ev.Message.Message).To(Equal("one"))
+		seen := ev.ID
+		Eventually(first).Should(Receive(&ev))
+
+		resumed := subscribe("", seen)
+		Eventually(resumed).Should(Receive(&ev))
+		Expect(ev.Message.Message).To(Equal("two"))
+
+		send("s", "three")
+		Eventually(resumed).Should(Receive(&ev))
+		Expect(ev.Message.Message).To(Equal("three"))
+		Consistently(resumed, "100ms").ShouldNot(Receive())
+	})
+
+	It("replays messages recorded outside the server", func() {
+		first := subscribe("", "")
+		send("s", "one")
+		var ev sseEvent
+		Eventually(first).Should(Receive(&ev))
+
+		Expect(api.RecordMessage(store, parser.AntigravityMessage{SessionID: "s", MessageID: 7, Message: "redriven"})).To(Succeed())
+		resumed := subscribe("", ev.ID)
+		Eventually(resumed).Should(Receive(&ev))
+		Expect(ev.Type).To(Equal(api.EventMessage))
+		Expect(ev.Message.Message).To(Equal("redriven"))
+	})
+
+	It("announces concept changes", func() {
+		events := subscribe("", "")
+		req := httptest.NewRequest(http.MethodPost, "/concepts", strings.NewReader(`{"id":"c","label":"C"}`))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+
+		var ev sseEvent
+		Eventually(events).Should(Receive(&ev))
+		Expect(ev.Type).To(Equal(api.EventConceptCreated))
+	})
+
+	It("rejects a malformed Last-Event-ID", func() {
+		req, _ := http.NewRequest(http.MethodGet, ts.URL+"/events", nil)
+		req.Header.Set("Last-Event-ID", "abc")
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).NotTo(HaveOccurred())
+		resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+})
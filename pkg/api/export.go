@@ -0,0 +1,73 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/export"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// handleExport returns the concept graph shaped for visualization, in the
+// export format named by the path: node-link, tree or timeline. The session
+// and namespace query parameters scope it; a tree takes its root concept
+// from root, and direction (out, in or both) and depth to shape it; a
+// timeline takes the width of its buckets from interval, e.g. 15m or 24h.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.PathValue("format")
+	if !slices.Contains(export.Formats, format) {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("Unknown export format %q", format))
+		return
+	}
+	q := r.URL.Query()
+	opts := export.Options{Root: q.Get("root")}
+	var err error
+	if opts.Direction, err = export.ParseDirection(q.Get("direction")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := q.Get("depth"); v != "" {
+		if opts.Depth, err = strconv.Atoi(v); err != nil || opts.Depth < 0 {
+			writeError(w, http.StatusBadRequest, "depth must be a non-negative integer")
+			return
+		}
+	}
+	if v := q.Get("interval"); v != "" {
+		if opts.Interval, err = time.ParseDuration(v); err != nil || opts.Interval <= 0 {
+			writeError(w, http.StatusBadRequest, "interval must be a positive duration, e.g. 15m")
+			return
+		}
+	}
+
+	store := s.store
+	if ns := storage.Namespace(q.Get("namespace")); ns != "" {
+		store, err = s.store.ExistingNamespace(ns)
+		if errors.Is(err, storage.ErrNotFound) {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("Namespace %q not found", ns))
+			return
+		}
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	g, err := export.Load(store, q.Get("session"))
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	shaped, err := g.Shape(format, opts)
+	switch {
+	case errors.Is(err, export.ErrNoRoot):
+		writeError(w, http.StatusBadRequest, "root is required for a tree")
+	case err != nil:
+		writeStorageError(w, err)
+	default:
+		writeJSON(w, http.StatusOK, shaped)
+	}
+}
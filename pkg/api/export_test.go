@@ -0,0 +1,103 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/export"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Export Endpoint", func() {
+	var (
+		server *api.Server
+		store  *storage.BoltStorage
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "export.db"))
+		Expect(err).NotTo(HaveOccurred())
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 1, handler, api.WithStore(store))
+
+		Expect(store.CreateConcept(&storage.Concept{ID: "a", Label: "alpha"})).To(Succeed())
+		Expect(store.CreateConcept(&storage.Concept{ID: "b", Label: "beta"})).To(Succeed())
+		Expect(store.CreateEdge(&storage.Edge{ID: "ab", From: "a", To: "b", Relation: "has"})).To(Succeed())
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	get := func(target string, out any) int {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if out != nil {
+			Expect(json.Unmarshal(rec.Body.Bytes(), out)).To(Succeed(), rec.Body.String())
+		}
+		return rec.Code
+	}
+
+	It("exports node-link JSON", func() {
+		var nl export.NodeLink
+		Expect(get("/export/node-link", &nl)).To(Equal(http.StatusOK))
+		Expect(nl.Nodes).To(HaveLen(2))
+		Expect(nl.Links).To(ConsistOf(HaveField("Source", "a")))
+	})
+
+	It("exports a tree from the given root", func() {
+		var tree export.TreeNode
+		Expect(get("/export/tree?root=b&direction=in", &tree)).To(Equal(http.StatusOK))
+		Expect(tree.ID).To(Equal("b"))
+		Expect(tree.Children).To(ConsistOf(HaveField("ID", "a")))
+	})
+
+	It("exports a timeline", func() {
+		var tl export.Timeline
+		Expect(get("/export/timeline?interval=24h", &tl)).To(Equal(http.StatusOK))
+		Expect(tl.Interval).To(Equal("24h0m0s"))
+		Expect(tl.Buckets).To(HaveLen(1))
+		Expect(tl.Buckets[0].Concepts).To(HaveLen(2))
+	})
+
+	It("scopes the export to a namespace", func() {
+		scoped, err := store.Namespace("team")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scoped.CreateConcept(&storage.Concept{ID: "z", Label: "zeta"})).To(Succeed())
+
+		var nl export.NodeLink
+		Expect(get("/export/node-link?namespace=team", &nl)).To(Equal(http.StatusOK))
+		Expect(nl.Nodes).To(ConsistOf(HaveField("ID", "z")))
+		Expect(nl.Graph.Namespace).To(Equal("team"))
+
+		Expect(get("/export/node-link?namespace=nobody", nil)).To(Equal(http.StatusNotFound))
+		namespaces, err := store.ListNamespaces("nobody")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(namespaces).To(BeEmpty())
+	})
+
+	DescribeTable("rejects bad requests",
+		func(target string, status int) {
+			var resp api.ErrorResponse
+			Expect(get(target, &resp)).To(Equal(status))
+			Expect(resp.Error).NotTo(BeEmpty())
+		},
+		Entry("unknown format", "/export/pie", http.StatusNotFound),
+		Entry("tree without a root", "/export/tree", http.StatusBadRequest),
+		Entry("tree from a missing root", "/export/tree?root=nope", http.StatusNotFound),
+		Entry("bad direction", "/export/tree?root=a&direction=up", http.StatusBadRequest),
+		Entry("bad depth", "/export/tree?root=a&depth=-1", http.StatusBadRequest),
+		Entry("bad interval", "/export/timeline?interval=soon", http.StatusBadRequest),
+	)
+})
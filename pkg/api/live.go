@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// Commands a client can send on /live.
+const (
+	CommandChat          = "chat"
+	CommandRenameConcept = "concept.rename"
+	CommandMergeConcepts = "concept.merge"
+	CommandDeleteEdge    = "edge.delete"
+)
+
+// Reply types sent on /live.
+const (
+	ReplyAck   = "ack"
+	ReplyEvent = "event"
+)
+
+// LiveCommand is a message from a /live client.
+type LiveCommand struct {
+	// ID is echoed in the acknowledgement so the client can match it up.
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type"`
+
+	// Message is the chat message of a chat command.
+	Message *IngestRequest `json:"message,omitempty"`
+	// ConceptID and Label are the concept to rename and its new label.
+	ConceptID string `json:"conceptId,omitempty"`
+	Label     string `json:"label,omitempty"`
+	// From is the concept merged into Into, which survives.
+	Into string `json:"into,omitempty"`
+	From string `json:"from,omitempty"`
+	// EdgeID is the edge to delete.
+	EdgeID string `json:"edgeId,omitempty"`
+}
+
+// LiveReply is a message to a /live client: either the acknowledgement of a
+// command, carrying its Result or Error, or a broadcast Event.
+type LiveReply struct {
+	Type   string          `json:"type"`
+	ID     string          `json:"id,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *ErrorResponse  `json:"error,omitempty"`
+	Event  *storage.Event  `json:"event,omitempty"`
+}
+
+// WithAllowedOrigins lets browser pages from these origins, such as
+// "https://example.com", open /live. Pages served by the API's own host are
+// always allowed, as are clients that send no Origin.
+func WithAllowedOrigins(origins ...string) Option {
+	return func(s *Server) {
+		s.allowedOrigins = append(s.allowedOrigins, origins...)
+	}
+}
+
+// originAllowed guards /live against pages on other sites driving a user's
+// local server, which browsers do not prevent for WebSockets.
+func (s *Server) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if slices.Contains(s.allowedOrigins, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// handleLive serves the /live WebSocket, over which a client sends chat
+// messages and curation commands and receives an acknowledgement for each,
+// along with the same events as /events. The session and lastEventId query
+// parameters filter and resume the events as they do there.
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r) {
+		writeError(w, http.StatusForbidden, "Origin not allowed")
+		return
+	}
+	lastID, err := lastEventID(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	conn, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+
+	sub := s.events.subscribe(r.URL.Query()["session"])
+	defer s.events.unsubscribe(sub)
+
+	done := make(chan struct{})
+	defer close(done)
+	go s.pushEvents(conn, sub, lastID, done)
+
+	for {
+		data, err := conn.readMessage()
+		if err != nil {
+			var ce *closeError
+			if errors.As(err, &ce) {
+				conn.close(ce.code, ce.reason)
+			} else {
+				conn.close(closeGoingAway, "")
+			}
+			return
+		}
+
+		var cmd LiveCommand
+		reply := LiveReply{Type: ReplyAck}
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			reply.Error = &ErrorResponse{Error: fmt.Sprintf("Invalid JSON: %v", err), Code: CodeBadRequest}
+		} else {
+			reply.ID = cmd.ID
+			reply.Result, reply.Error = s.runCommand(r, cmd)
+		}
+		out, _ := json.Marshal(reply)
+		if err := conn.writeText(out); err != nil {
+			conn.close(closeGoingAway, "")
+			return
+		}
+	}
+}
+
+// pushEvents writes sub's events to conn, after replaying those stored since
+// lastID, and pings the client while idle. It closes the connection if the
+// client falls too far behind or the server shuts down.
+func (s *Server) pushEvents(conn *wsConn, sub *subscriber, lastID uint64, done <-chan struct{}) {
+	send := func(ev storage.Event) bool {
+		out, _ := json.Marshal(LiveReply{Type: ReplyEvent, Event: &ev})
+		return conn.writeText(out) == nil
+	}
+	lastID, err := s.replay(sub, lastID, send)
+	if err != nil {
+		conn.close(closeInternalError, "could not read stored events")
+		return
+	}
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ping.C:
+			if conn.writeFrame(opPing, nil) != nil {
+				conn.close(closeGoingAway, "")
+				return
+			}
+		case ev, ok := <-sub.events:
+			if !ok {
+				if sub.lagged {
+					conn.close(closeTryAgainLater, "too far behind; reconnect with lastEventId")
+				} else {
+					conn.close(closeGoingAway, "server shutting down")
+				}
+				return
+			}
+			if ev.ID != 0 && ev.ID <= lastID {
+				continue
+			}
+			if !send(ev) {
+				conn.close(closeGoingAway, "")
+				return
+			}
+		}
+	}
+}
+
+// runCommand carries out cmd and returns the result or error to
+// acknowledge it with.
+func (s *Server) runCommand(r *http.Request, cmd LiveCommand) (json.RawMessage, *ErrorResponse) {
+	var (
+		result any
+		err    error
+	)
+	switch cmd.Type {
+	case CommandChat:
+		if cmd.Message == nil {
+			return nil, &ErrorResponse{Error: "message is required", Code: CodeBadRequest}
+		}
+		result, err = s.accept(r.Context(), *cmd.Message, "")
+		if err != nil {
+			status := ingestStatus(err)
+			return nil, &ErrorResponse{Error: ingestErrorText(status, err), Code: errorCodes[status]}
+		}
+	case CommandRenameConcept, CommandMergeConcepts, CommandDeleteEdge:
+		if s.store == nil {
+			return nil, &ErrorResponse{Error: "Persistence is disabled on this server", Code: CodeUnavailable}
+		}
+		switch cmd.Type {
+		case CommandRenameConcept:
+			result, err = s.renameConcept(cmd.ConceptID, cmd.Label)
+		case CommandMergeConcepts:
+			result, err = s.mergeConcepts(cmd.Into, cmd.From)
+		case CommandDeleteEdge:
+			err = s.deleteEdge(cmd.EdgeID)
+			result = map[string]string{"id": cmd.EdgeID}
+		}
+		if err != nil {
+			status := storageStatus(err)
+			return nil, &ErrorResponse{Error: storageErrorText(status, err), Code: errorCodes[status]}
+		}
+	default:
+		return nil, &ErrorResponse{Error: fmt.Sprintf("unknown command type %q", cmd.Type), Code: CodeBadRequest}
+	}
+
+	out, err := json.Marshal(result)
+	if err != nil {
+		return nil, &ErrorResponse{Error: "Failed to encode result", Code: CodeInternal}
+	}
+	return out, nil
+}
+
+// renameConcept gives a concept a new label, keeping the old one as an
+// alias, and broadcasts the change.
+func (s *Server) renameConcept(id, label string) (*storage.Concept, error) {
+	if id == "" || label == "" {
+		return nil, fmt.Errorf("%w: conceptId and label are required", errInvalid)
+	}
+	c, err := s.store.RenameConcept(id, label)
+	if err != nil {
+		return nil, err
+	}
+	s.events.publish(EventConceptUpdated, "", c)
+	return c, nil
+}
+
+// mergeConcepts folds one concept into another and broadcasts the result.
+func (s *Server) mergeConcepts(into, from string) (*storage.MergeResult, error) {
+	if into == "" || from == "" {
+		return nil, fmt.Errorf("%w: into and from are required", errInvalid)
+	}
+	result, err := s.store.MergeConcepts(into, from)
+	if err != nil {
+		return nil, err
+	}
+	s.events.publish(EventConceptMerged, "", result)
+	return result, nil
+}
+
+// deleteEdge removes an edge and broadcasts its removal.
+func (s *Server) deleteEdge(id string) error {
+	if err := s.store.DeleteEdge(id); err != nil {
+		return err
+	}
+	s.events.publish(EventEdgeDeleted, "", map[string]string{"id": id})
+	return nil
+}
@@ -0,0 +1,377 @@
+package api_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// wsClient is just enough of a WebSocket client to talk to /live.
+type wsClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialLive opens /live on ts, sending origin if it is set, and returns the
+// client with the handshake response.
+func dialLive(ts *httptest.Server, query, origin string) (*wsClient, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(ts.URL, "http://"))
+	Expect(err).NotTo(HaveOccurred())
+	DeferCleanup(conn.Close)
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/live"+query, nil)
+	Expect(err).NotTo(HaveOccurred())
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	Expect(req.Write(conn)).To(Succeed())
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	Expect(err).NotTo(HaveOccurred())
+	return &wsClient{conn: conn, r: r}, resp
+}
+
+// send writes v as a masked text frame.
+func (c *wsClient) send(v any) {
+	payload, err := json.Marshal(v)
+	Expect(err).NotTo(HaveOccurred())
+	c.sendFrame(0x1, payload)
+}
+
+func (c *wsClient) sendFrame(op byte, payload []byte) {
+	frame := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n <= 125:
+		frame = append(frame, 0x80|byte(n))
+	default:
+		frame = append(frame, 0x80|126, byte(n>>8), byte(n))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	Expect(err).NotTo(HaveOccurred())
+}
+
+// readFrame reads one unmasked server frame.
+func (c *wsClient) readFrame() (byte, []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var head [2]byte
+	_, err := io.ReadFull(c.r, head[:])
+	Expect(err).NotTo(HaveOccurred())
+	length := int(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		_, err = io.ReadFull(c.r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		_, err = io.ReadFull(c.r, ext[:])
+		length = int(binary.BigEndian.Uint64(ext[:]))
+	}
+	Expect(err).NotTo(HaveOccurred())
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.r, payload)
+	Expect(err).NotTo(HaveOccurred())
+	return head[0] & 0x0f, payload
+}
+
+// next returns the next reply, skipping pings.
+func (c *wsClient) next() api.LiveReply {
+	for {
+		op, payload := c.readFrame()
+		if op == 0x9 {
+			continue
+		}
+		Expect(op).To(BeEquivalentTo(0x1), "frame payload %q", payload)
+		var reply api.LiveReply
+		Expect(json.Unmarshal(payload, &reply)).To(Succeed())
+		return reply
+	}
+}
+
+// ack returns the acknowledgement of the command with id, and the events
+// that arrived before it.
+func (c *wsClient) ack(id string) (api.LiveReply, []storage.Event) {
+	var events []storage.Event
+	for {
+		reply := c.next()
+		if reply.Type == api.ReplyEvent {
+			events = append(events, *reply.Event)
+			continue
+		}
+		Expect(reply.ID).To(Equal(id))
+		return reply, events
+	}
+}
+
+// nextEvent returns the next broadcast event, failing on an acknowledgement.
+func (c *wsClient) nextEvent() storage.Event {
+	reply := c.next()
+	Expect(reply.Type).To(Equal(api.ReplyEvent))
+	return *reply.Event
+}
+
+// ackAndEvent returns the acknowledgement of the command with id and the
+// first event after the command was sent, which may arrive either side of
+// the acknowledgement.
+func (c *wsClient) ackAndEvent(id string) (api.LiveReply, storage.Event) {
+	ack, events := c.ack(id)
+	if len(events) > 0 {
+		return ack, events[0]
+	}
+	return ack, c.nextEvent()
+}
+
+var _ = Describe("Live WebSocket", func() {
+	var (
+		server *api.Server
+		store  *storage.BoltStorage
+		ts     *httptest.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "live.db"))
+		Expect(err).NotTo(HaveOccurred())
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 2, handler, api.WithStore(store), api.WithOrderedDelivery(),
+			api.WithAllowedOrigins("https://viewer.example"))
+		ts = httptest.NewServer(server.Handler())
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		ts.Close()
+	})
+
+	open := func() *wsClient {
+		c, resp := dialLive(ts, "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		return c
+	}
+
+	createConcept := func(id, label string) {
+		Expect(store.CreateConcept(&storage.Concept{ID: id, Label: label})).To(Succeed())
+	}
+
+	It("completes the opening handshake", func() {
+		_, resp := dialLive(ts, "", "")
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		Expect(resp.Header.Get("Upgrade")).To(Equal("websocket"))
+		Expect(resp.Header.Get("Sec-WebSocket-Accept")).NotTo(BeEmpty())
+	})
+
+	It("acknowledges a chat message and broadcasts it once processed", func() {
+		c := open()
+		c.send(api.LiveCommand{ID: "1", Type: api.CommandChat, Message: &api.IngestRequest{
+			SessionID: "s", Type: "user", Message: "hello",
+		}})
+
+		ack, ev := c.ackAndEvent("1")
+		Expect(ack.Error).To(BeNil())
+		var resp api.IngestResponse
+		Expect(json.Unmarshal(ack.Result, &resp)).To(Succeed())
+		Expect(resp.SessionID).To(Equal("s"))
+
+		Expect(ev.Type).To(Equal(api.EventMessage))
+		Expect(ev.SessionID).To(Equal("s"))
+	})
+
+	It("broadcasts to other connections", func() {
+		createConcept("a", "alpha")
+		watcher, curator := open(), open()
+
+		curator.send(api.LiveCommand{ID: "r", Type: api.CommandRenameConcept, ConceptID: "a", Label: "Alpha"})
+		ack, _ := curator.ack("r")
+		Expect(ack.Error).To(BeNil())
+
+		ev := watcher.nextEvent()
+		Expect(ev.Type).To(Equal(api.EventConceptUpdated))
+		var c storage.Concept
+		Expect(json.Unmarshal(ev.Data, &c)).To(Succeed())
+		Expect(c.Label).To(Equal("Alpha"))
+		Expect(c.Aliases).To(ConsistOf("alpha"))
+	})
+
+	It("merges concepts", func() {
+		createConcept("a", "alpha")
+		createConcept("b", "beta")
+		createConcept("c", "gamma")
+		Expect(store.CreateEdge(&storage.Edge{ID: "e1", From: "b", To: "c", Relation: "uses"})).To(Succeed())
+
+		c := open()
+		c.send(api.LiveCommand{ID: "m", Type: api.CommandMergeConcepts, Into: "a", From: "b"})
+		ack, ev := c.ackAndEvent("m")
+		Expect(ack.Error).To(BeNil())
+		var result storage.MergeResult
+		Expect(json.Unmarshal(ack.Result, &result)).To(Succeed())
+		Expect(result.Removed).To(Equal("b"))
+		Expect(result.Concept.Aliases).To(ContainElement("beta"))
+
+		Expect(ev.Type).To(Equal(api.EventConceptMerged))
+		e, err := store.GetEdge("e1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(e.From).To(Equal("a"))
+	})
+
+	It("deletes edges", func() {
+		createConcept("a", "alpha")
+		createConcept("b", "beta")
+		Expect(store.CreateEdge(&storage.Edge{ID: "e1", From: "a", To: "b", Relation: "uses"})).To(Succeed())
+
+		c := open()
+		c.send(api.LiveCommand{ID: "d", Type: api.CommandDeleteEdge, EdgeID: "e1"})
+		ack, ev := c.ackAndEvent("d")
+		Expect(ack.Error).To(BeNil())
+		Expect(ev.Type).To(Equal(api.EventEdgeDeleted))
+		Expect(store.GetEdge("e1")).To(BeNil())
+	})
+
+	DescribeTable("acknowledges failed commands with an error",
+		func(cmd api.LiveCommand, code string) {
+			c := open()
+			cmd.ID = "x"
+			c.send(cmd)
+			ack, _ := c.ack("x")
+			Expect(ack.Result).To(BeNil())
+			Expect(ack.Error).NotTo(BeNil())
+			Expect(ack.Error.Code).To(Equal(code))
+		},
+		Entry("unknown command", api.LiveCommand{Type: "concept.explode"}, api.CodeBadRequest),
+		Entry("chat without a message", api.LiveCommand{Type: api.CommandChat}, api.CodeBadRequest),
+		Entry("renaming a missing concept", api.LiveCommand{Type: api.CommandRenameConcept, ConceptID: "nope", Label: "x"}, api.CodeNotFound),
+		Entry("merging a concept into itself", api.LiveCommand{Type: api.CommandMergeConcepts, Into: "a", From: "a"}, api.CodeBadRequest),
+		Entry("deleting a missing edge", api.LiveCommand{Type: api.CommandDeleteEdge, EdgeID: "nope"}, api.CodeNotFound),
+	)
+
+	It("keeps the connection open after a malformed command", func() {
+		c := open()
+		c.sendFrame(0x1, []byte("{not json"))
+		reply := c.next()
+		Expect(reply.Type).To(Equal(api.ReplyAck))
+		Expect(reply.Error.Code).To(Equal(api.CodeBadRequest))
+
+		c.send(api.LiveCommand{ID: "after", Type: "nope"})
+		ack, _ := c.ack("after")
+		Expect(ack.Error).NotTo(BeNil())
+	})
+
+	It("answers a ping with a pong", func() {
+		c := open()
+		c.sendFrame(0x9, []byte("hi"))
+		op, payload := c.readFrame()
+		Expect(op).To(BeEquivalentTo(0xA))
+		Expect(string(payload)).To(Equal("hi"))
+	})
+
+	It("echoes the client's close", func() {
+		c := open()
+		c.sendFrame(0x8, binary.BigEndian.AppendUint16(nil, 1000))
+		op, payload := c.readFrame()
+		Expect(op).To(BeEquivalentTo(0x8))
+		Expect(binary.BigEndian.Uint16(payload)).To(BeEquivalentTo(1000))
+	})
+
+	DescribeTable("answers an invalid close with a protocol error",
+		func(payload []byte) {
+			c := open()
+			c.sendFrame(0x8, payload)
+			op, reply := c.readFrame()
+			Expect(op).To(BeEquivalentTo(0x8))
+			Expect(binary.BigEndian.Uint16(reply)).To(BeEquivalentTo(1002))
+		},
+		Entry("one-byte payload", []byte{0x03}),
+		Entry("code 1005", binary.BigEndian.AppendUint16(nil, 1005)),
+		Entry("code 1006", binary.BigEndian.AppendUint16(nil, 1006)),
+		Entry("code 999", binary.BigEndian.AppendUint16(nil, 999)),
+		Entry("code 5000", binary.BigEndian.AppendUint16(nil, 5000)),
+		Entry("reason not UTF-8", append(binary.BigEndian.AppendUint16(nil, 1000), 0xff)),
+	)
+
+	It("echoes an application's close code", func() {
+		c := open()
+		c.sendFrame(0x8, binary.BigEndian.AppendUint16(nil, 4000))
+		op, payload := c.readFrame()
+		Expect(op).To(BeEquivalentTo(0x8))
+		Expect(binary.BigEndian.Uint16(payload)).To(BeEquivalentTo(4000))
+	})
+
+	It("closes a connection that sends binary messages", func() {
+		c := open()
+		c.sendFrame(0x2, []byte{0, 1})
+		op, payload := c.readFrame()
+		Expect(op).To(BeEquivalentTo(0x8))
+		Expect(binary.BigEndian.Uint16(payload)).To(BeEquivalentTo(1003))
+	})
+
+	It("replays missed events to a client resuming with lastEventId", func() {
+		createConcept("a", "alpha")
+		first := open()
+		first.send(api.LiveCommand{ID: "r1", Type: api.CommandRenameConcept, ConceptID: "a", Label: "one"})
+		_, seen := first.ackAndEvent("r1")
+		first.send(api.LiveCommand{ID: "r2", Type: api.CommandRenameConcept, ConceptID: "a", Label: "two"})
+		first.ack("r2")
+
+		c, resp := dialLive(ts, fmt.Sprintf("?lastEventId=%d", seen.ID), "")
+		Expect(resp.StatusCode).To(Equal(http.StatusSwitchingProtocols))
+		ev := c.nextEvent()
+		Expect(ev.ID).To(BeNumerically(">", seen.ID))
+		Expect(string(ev.Data)).To(ContainSubstring(`"label":"two"`))
+	})
+
+	DescribeTable("checks the Origin of browser clients",
+		func(origin func() string, status int) {
+			_, resp := dialLive(ts, "", origin())
+			Expect(resp.StatusCode).To(Equal(status))
+		},
+		Entry("same host", func() string { return ts.URL }, http.StatusSwitchingProtocols),
+		Entry("allowed origin", func() string { return "https://viewer.example" }, http.StatusSwitchingProtocols),
+		Entry("other site", func() string { return "https://evil.example" }, http.StatusForbidden),
+	)
+
+	It("rejects plain HTTP requests", func() {
+		resp, err := http.Get(ts.URL + "/live")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+	})
+
+	It("closes connections when the server shuts down", func() {
+		c := open()
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		op, payload := c.readFrame()
+		Expect(op).To(BeEquivalentTo(0x8))
+		Expect(binary.BigEndian.Uint16(payload)).To(BeEquivalentTo(1001))
+	})
+})
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+const (
+	// defaultPageSize and maxPageSize bound the limit query parameter of
+	// list endpoints.
+	defaultPageSize = 50
+	maxPageSize     = 500
+	// maxResourceBody caps the body of a concept or edge write.
+	maxResourceBody = 1 << 20
+)
+
+// Page is one page of a listing. NextCursor is passed back as the cursor
+// query parameter to get the following page, and is empty on the last one.
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// SessionSummary is an entry of the session listing.
+type SessionSummary struct {
+	ID string `json:"id"`
+}
+
+// routeResources registers the read and curation endpoints for what the
+// datastore holds: sessions and their messages, concepts and edges.
+func (s *Server) routeResources(mux *http.ServeMux) {
+	mux.HandleFunc("GET /sessions", s.withStore(s.handleListSessions))
+	mux.HandleFunc("GET /sessions/{session}/messages", s.withStore(s.handleListMessages))
+	mux.HandleFunc("GET /sessions/{session}/messages/{id}", s.withStore(s.handleGetMessage))
+
+	mux.HandleFunc("GET /concepts", s.withStore(s.handleListConcepts))
+	mux.HandleFunc("POST /concepts", s.withStore(s.handleCreateConcept))
+	mux.HandleFunc("GET /concepts/{id}", s.withStore(s.handleGetConcept))
+	mux.HandleFunc("PUT /concepts/{id}", s.withStore(s.handleUpdateConcept))
+	mux.HandleFunc("DELETE /concepts/{id}", s.withStore(s.handleDeleteConcept))
+
+	mux.HandleFunc("GET /edges", s.withStore(s.handleListEdges))
+	mux.HandleFunc("POST /edges", s.withStore(s.handleCreateEdge))
+	mux.HandleFunc("GET /edges/{id}", s.withStore(s.handleGetEdge))
+	mux.HandleFunc("PUT /edges/{id}", s.withStore(s.handleUpdateEdge))
+	mux.HandleFunc("DELETE /edges/{id}", s.withStore(s.handleDeleteEdge))
+}
+
+// withStore answers 503 in place of h when the server was started without a
+// datastore, since there is then nothing to read or curate.
+func (s *Server) withStore(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.store == nil {
+			writeError(w, http.StatusServiceUnavailable, "Persistence is disabled on this server")
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (s *Server) handleListSessions(w http.ResponseWriter, r *http.Request) {
+	after, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	ids, err := s.store.ListSessionsAfter(after, limit+1)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	items := make([]SessionSummary, len(ids))
+	for i, id := range ids {
+		items[i] = SessionSummary{ID: id}
+	}
+	writeJSON(w, http.StatusOK, page(items, limit, func(s SessionSummary) string { return s.ID }))
+}
+
+func (s *Server) handleListMessages(w http.ResponseWriter, r *http.Request) {
+	session := r.PathValue("session")
+	cursor, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	after := -1
+	if cursor != "" {
+		id, err := strconv.Atoi(cursor)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "Invalid cursor")
+			return
+		}
+		after = id
+	}
+
+	msgs, err := s.store.ListSessionMessagesAfter(session, after, limit+1)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if len(msgs) == 0 && after < 0 {
+		// An empty first page means there is no such session, unless it
+		// was created without messages.
+		exists, err := s.store.SessionExists(session)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, fmt.Sprintf("session %s: not found", session))
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, page(msgs, limit, func(m parser.AntigravityMessage) string {
+		return strconv.Itoa(m.MessageID)
+	}))
+}
+
+func (s *Server) handleGetMessage(w http.ResponseWriter, r *http.Request) {
+	session := r.PathValue("session")
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid message id %q", r.PathValue("id")))
+		return
+	}
+	msg, err := s.store.GetMessage(session, id)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if msg == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("message %s/%d: not found", session, id))
+		return
+	}
+	writeJSON(w, http.StatusOK, msg)
+}
+
+func (s *Server) handleListConcepts(w http.ResponseWriter, r *http.Request) {
+	after, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	concepts, err := s.store.ListConceptsAfter(after, limit+1)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page(concepts, limit, func(c storage.Concept) string { return c.ID }))
+}
+
+func (s *Server) handleGetConcept(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	c, err := s.store.GetConcept(id)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if c == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("concept %s: not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (s *Server) handleCreateConcept(w http.ResponseWriter, r *http.Request) {
+	var c storage.Concept
+	if !decodeResource(w, r, &c) {
+		return
+	}
+	if c.Label == "" {
+		writeError(w, http.StatusBadRequest, "label is required")
+		return
+	}
+	if err := s.store.CreateConcept(&c); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	s.events.publish(EventConceptCreated, "", c)
+	w.Header().Set("Location", "/concepts/"+c.ID)
+	writeJSON(w, http.StatusCreated, c)
+}
+
+// handleUpdateConcept replaces a concept with the request body.
+func (s *Server) handleUpdateConcept(w http.ResponseWriter, r *http.Request) {
+	var c storage.Concept
+	if !decodeResource(w, r, &c) || !pathID(w, r, &c.ID) {
+		return
+	}
+	if c.Label == "" {
+		writeError(w, http.StatusBadRequest, "label is required")
+		return
+	}
+	if err := s.store.UpdateConcept(&c); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	s.events.publish(EventConceptUpdated, "", c)
+	writeJSON(w, http.StatusOK, c)
+}
+
+// handleDeleteConcept removes a concept and every edge touching it.
+func (s *Server) handleDeleteConcept(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.store.DeleteConcept(id); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	s.events.publish(EventConceptDeleted, "", map[string]string{"id": id})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListEdges(w http.ResponseWriter, r *http.Request) {
+	after, limit, ok := pageParams(w, r)
+	if !ok {
+		return
+	}
+	edges, err := s.store.ListEdgesAfter(after, limit+1)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page(edges, limit, func(e storage.Edge) string { return e.ID }))
+}
+
+func (s *Server) handleGetEdge(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	e, err := s.store.GetEdge(id)
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if e == nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("edge %s: not found", id))
+		return
+	}
+	writeJSON(w, http.StatusOK, e)
+}
+
+func (s *Server) handleCreateEdge(w http.ResponseWriter, r *http.Request) {
+	var e storage.Edge
+	if !decodeResource(w, r, &e) || !validEdge(w, &e) {
+		return
+	}
+	if err := s.store.CreateEdge(&e); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	s.events.publish(EventEdgeCreated, "", e)
+	w.Header().Set("Location", "/edges/"+e.ID)
+	writeJSON(w, http.StatusCreated, e)
+}
+
+// handleUpdateEdge replaces an edge with the request body.
+func (s *Server) handleUpdateEdge(w http.ResponseWriter, r *http.Request) {
+	var e storage.Edge
+	if !decodeResource(w, r, &e) || !pathID(w, r, &e.ID) || !validEdge(w, &e) {
+		return
+	}
+	if err := s.store.UpdateEdge(&e); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	s.events.publish(EventEdgeUpdated, "", e)
+	writeJSON(w, http.StatusOK, e)
+}
+
+func (s *Server) handleDeleteEdge(w http.ResponseWriter, r *http.Request) {
+	if err := s.deleteEdge(r.PathValue("id")); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validEdge checks the fields an edge cannot do without, answering 400 if
+// one is missing.
+func validEdge(w http.ResponseWriter, e *storage.Edge) bool {
+	switch {
+	case e.From == "" || e.To == "":
+		writeError(w, http.StatusBadRequest, "from and to are required")
+	case e.Relation == "":
+		writeError(w, http.StatusBadRequest, "relation is required")
+	default:
+		return true
+	}
+	return false
+}
+
+// decodeResource reads a concept or edge from the request body into v,
+// answering 400 or 413 if it cannot.
+func decodeResource(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxResourceBody)).Decode(v)
+	if err == nil {
+		return true
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, "Request body too large")
+	} else {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
+	}
+	return false
+}
+
+// pathID sets *id from the URL, answering 400 if the body named another.
+func pathID(w http.ResponseWriter, r *http.Request, id *string) bool {
+	want := r.PathValue("id")
+	if *id != "" && *id != want {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("body id %q does not match %q in the URL", *id, want))
+		return false
+	}
+	*id = want
+	return true
+}
+
+// pageParams reads the cursor and limit query parameters, answering 400 if
+// either is malformed. The cursor is returned decoded.
+func pageParams(w http.ResponseWriter, r *http.Request) (string, int, bool) {
+	q := r.URL.Query()
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return "", 0, false
+		}
+		limit = min(n, maxPageSize)
+	}
+	cursor, err := base64.RawURLEncoding.DecodeString(q.Get("cursor"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid cursor")
+		return "", 0, false
+	}
+	return string(cursor), limit, true
+}
+
+// page builds a Page from items fetched with one more than limit, which
+// tells whether another page follows. key gives the position of an item
+// that the next page starts after.
+func page[T any](items []T, limit int, key func(T) string) Page[T] {
+	p := Page[T]{Items: items}
+	if p.Items == nil {
+		p.Items = []T{}
+	}
+	if len(items) > limit {
+		p.Items = items[:limit]
+		p.NextCursor = base64.RawURLEncoding.EncodeToString([]byte(key(items[limit-1])))
+	}
+	return p
+}
+
+// writeStorageError answers with the status matching a datastore error.
+func writeStorageError(w http.ResponseWriter, err error) {
+	status := storageStatus(err)
+	writeError(w, status, storageErrorText(status, err))
+}
+
+// storageStatus maps an error from the datastore, or from validating a
+// change to it, to an HTTP status.
+func storageStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalid), errors.Is(err, storage.ErrInvalidID), errors.Is(err, storage.ErrMissingEndpoint),
+		errors.Is(err, storage.ErrSelfMerge), errors.Is(err, storage.ErrNoLabel):
+		return http.StatusBadRequest
+	case errors.Is(err, storage.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, storage.ErrExists):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// storageErrorText describes a datastore error that was given status,
+// without exposing the details of internal failures.
+func storageErrorText(status int, err error) string {
+	if status == http.StatusInternalServerError {
+		return "Datastore error"
+	}
+	return err.Error()
+}
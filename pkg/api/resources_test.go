@@ -0,0 +1,141 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Resource Endpoints", func() {
+	var (
+		server *api.Server
+		store  *storage.BoltStorage
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "resources.db"))
+		Expect(err).NotTo(HaveOccurred())
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 1, handler, api.WithStore(store))
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	// call sends a request to the server and decodes its JSON body into out,
+	// if given.
+	call := func(method, target, body string, out any) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		if out != nil {
+			Expect(json.Unmarshal(rec.Body.Bytes(), out)).To(Succeed(), rec.Body.String())
+		}
+		return rec.Code
+	}
+
+	It("pages through a session's messages with a cursor", func() {
+		for i := 0; i < 5; i++ {
+			Expect(store.SaveMessage(parser.AntigravityMessage{
+				SessionID: "s", MessageID: i, Type: "user", Timestamp: time.Now(),
+			})).To(Succeed())
+		}
+
+		var ids []int
+		cursor := ""
+		for pages := 0; ; pages++ {
+			Expect(pages).To(BeNumerically("<", 5))
+			var page api.Page[parser.AntigravityMessage]
+			target := "/sessions/s/messages?limit=2&cursor=" + url.QueryEscape(cursor)
+			Expect(call(http.MethodGet, target, "", &page)).To(Equal(http.StatusOK))
+			for _, m := range page.Items {
+				ids = append(ids, m.MessageID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		Expect(ids).To(Equal([]int{0, 1, 2, 3, 4}))
+
+		var msg parser.AntigravityMessage
+		Expect(call(http.MethodGet, "/sessions/s/messages/3", "", &msg)).To(Equal(http.StatusOK))
+		Expect(msg.MessageID).To(Equal(3))
+
+		var sessions api.Page[api.SessionSummary]
+		Expect(call(http.MethodGet, "/sessions", "", &sessions)).To(Equal(http.StatusOK))
+		Expect(sessions.Items).To(Equal([]api.SessionSummary{{ID: "s"}}))
+		Expect(sessions.NextCursor).To(BeEmpty())
+	})
+
+	It("creates, updates and deletes concepts and edges", func() {
+		var a, b storage.Concept
+		Expect(call(http.MethodPost, "/concepts", `{"id":"a","label":"Alpha"}`, &a)).To(Equal(http.StatusCreated))
+		Expect(call(http.MethodPost, "/concepts", `{"label":"Beta"}`, &b)).To(Equal(http.StatusCreated))
+		Expect(b.ID).NotTo(BeEmpty())
+
+		var edge storage.Edge
+		body := `{"id":"e","from":"a","to":"` + b.ID + `","relation":"relates"}`
+		Expect(call(http.MethodPost, "/edges", body, &edge)).To(Equal(http.StatusCreated))
+
+		var renamed storage.Concept
+		Expect(call(http.MethodPut, "/concepts/a", `{"label":"Alpha prime"}`, &renamed)).To(Equal(http.StatusOK))
+		Expect(renamed.Label).To(Equal("Alpha prime"))
+		Expect(renamed.CreatedAt).To(BeTemporally("~", a.CreatedAt))
+
+		var concepts api.Page[storage.Concept]
+		Expect(call(http.MethodGet, "/concepts?limit=1", "", &concepts)).To(Equal(http.StatusOK))
+		Expect(concepts.Items).To(HaveLen(1))
+		Expect(concepts.NextCursor).NotTo(BeEmpty())
+
+		Expect(call(http.MethodDelete, "/concepts/a", "", nil)).To(Equal(http.StatusNoContent))
+		var errResp api.ErrorResponse
+		Expect(call(http.MethodGet, "/edges/e", "", &errResp)).To(Equal(http.StatusNotFound))
+		Expect(errResp.Code).To(Equal(api.CodeNotFound))
+	})
+
+	DescribeTable("answers errors with a JSON body",
+		func(method, target, body string, status int, code string) {
+			var errResp api.ErrorResponse
+			Expect(call(method, target, body, &errResp)).To(Equal(status))
+			Expect(errResp.Code).To(Equal(code))
+			Expect(errResp.Error).NotTo(BeEmpty())
+		},
+		Entry("unknown session", http.MethodGet, "/sessions/none/messages", "", http.StatusNotFound, api.CodeNotFound),
+		Entry("bad message id", http.MethodGet, "/sessions/s/messages/x", "", http.StatusBadRequest, api.CodeBadRequest),
+		Entry("bad cursor", http.MethodGet, "/concepts?cursor=!!", "", http.StatusBadRequest, api.CodeBadRequest),
+		Entry("bad limit", http.MethodGet, "/concepts?limit=0", "", http.StatusBadRequest, api.CodeBadRequest),
+		Entry("missing label", http.MethodPost, "/concepts", `{}`, http.StatusBadRequest, api.CodeBadRequest),
+		Entry("id with NUL", http.MethodPost, "/concepts", `{"id":"a\u0000b","label":"A"}`, http.StatusBadRequest, api.CodeBadRequest),
+		Entry("id with slash", http.MethodPost, "/concepts", `{"id":"a/b","label":"A"}`, http.StatusBadRequest, api.CodeBadRequest),
+		Entry("dangling edge", http.MethodPost, "/edges", `{"from":"x","to":"y","relation":"r"}`, http.StatusBadRequest, api.CodeBadRequest),
+		Entry("mismatched id", http.MethodPut, "/concepts/a", `{"id":"b","label":"B"}`, http.StatusBadRequest, api.CodeBadRequest),
+		Entry("update missing", http.MethodPut, "/concepts/zz", `{"label":"Z"}`, http.StatusNotFound, api.CodeNotFound),
+		Entry("delete missing", http.MethodDelete, "/edges/zz", "", http.StatusNotFound, api.CodeNotFound),
+		Entry("unknown route", http.MethodGet, "/nowhere", "", http.StatusNotFound, api.CodeNotFound),
+		Entry("wrong method", http.MethodDelete, "/ingest", "", http.StatusMethodNotAllowed, api.CodeMethodNotAllowed),
+	)
+
+	It("reports a conflict when creating a concept twice", func() {
+		Expect(call(http.MethodPost, "/concepts", `{"id":"a","label":"A"}`, nil)).To(Equal(http.StatusCreated))
+		var errResp api.ErrorResponse
+		Expect(call(http.MethodPost, "/concepts", `{"id":"a","label":"A"}`, &errResp)).To(Equal(http.StatusConflict))
+		Expect(errResp.Code).To(Equal(api.CodeConflict))
+	})
+})
@@ -1,97 +1,528 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
+	"github.com/gnomatix/enkente/pkg/storage"
 )
 
 // IngestRequest represents a message submitted via the REST API.
 type IngestRequest struct {
-	Type    string `json:"type"`
-	User    string `json:"user,omitempty"`
-	Message string `json:"message"`
+	// SessionID names the conversation the message belongs to; empty means
+	// DefaultSession. Sessions can also be started with POST /sessions.
+	SessionID string `json:"sessionId,omitempty"`
+	Type      string `json:"type"`
+	User      string `json:"user,omitempty"`
+	Message   string `json:"message"`
+
+	// Timestamp is when the message was sent, in RFC 3339 format. Empty
+	// means the time it was received.
+	Timestamp string `json:"timestamp,omitempty"`
+	// ClientMessageID is the sender's own id for the message, and ReplyTo
+	// the ClientMessageID of the message it answers.
+	ClientMessageID string `json:"clientMessageId,omitempty"`
+	ReplyTo         string `json:"replyTo,omitempty"`
+	// Channel and Thread place the message within the sender's chat tool.
+	Channel string `json:"channel,omitempty"`
+	Thread  string `json:"thread,omitempty"`
+	// Metadata carries any other string key/value pairs.
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// IngestResponse is the body of a 202 from /ingest, telling the client which
+// ids its message was given.
+type IngestResponse struct {
+	Status    string `json:"status"`
+	SessionID string `json:"sessionId"`
+	MessageID int    `json:"messageId"`
+	// Replayed is set when the message repeats one already accepted under
+	// the same idempotency key; the ids are those of the original.
+	Replayed bool `json:"replayed,omitempty"`
 }
 
+// IdempotencyHeader is the request header a client sets to make retries of
+// the same /ingest request safe.
+const IdempotencyHeader = "Idempotency-Key"
+
 // Server manages the HTTP ingestion endpoint and dispatches messages to a handler.
 type Server struct {
-	port    int
-	handler func(workerID int, msg parser.AntigravityMessage)
-	msgChan chan parser.AntigravityMessage
+	port   int
+	http   *http.Server
+	pool   *pipeline.Pool[parser.AntigravityMessage]
+	cfg    pipeline.Config[parser.AntigravityMessage]
+	store  *storage.BoltStorage
+	ids    *messageIDs
+	events *hub
+
+	// enqueueWait bounds how long a request waits for room in a full queue
+	// before it is turned away with 429.
+	enqueueWait time.Duration
+	// dedupTTL is how long idempotency keys are remembered.
+	dedupTTL time.Duration
+	// allowedOrigins are the browser origins, besides the server's own,
+	// that may open /live.
+	allowedOrigins []string
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithOrderedDelivery shards messages onto workers by session id so each
+// session's messages are handled in the order they were received.
+func WithOrderedDelivery() Option {
+	return func(s *Server) {
+		s.cfg.Key = parser.SessionKey
+	}
+}
+
+// WithRetries tries a failing message up to attempts times, pausing for
+// backoff before the first retry and twice as long before each one after.
+func WithRetries(attempts int, backoff time.Duration) Option {
+	return func(s *Server) {
+		s.cfg.MaxAttempts = attempts
+		s.cfg.Backoff = backoff
+	}
+}
+
+// WithFailureHandler is called for each message that failed every attempt.
+func WithFailureHandler(fn func(workerID int, msg parser.AntigravityMessage, err error, attempts int)) Option {
+	return func(s *Server) {
+		s.cfg.OnFailure = fn
+	}
+}
+
+// WithQueueDepth sets how many messages can wait for a worker. With ordered
+// delivery each worker has a queue of this depth.
+func WithQueueDepth(depth int) Option {
+	return func(s *Server) {
+		s.cfg.QueueSize = depth
+	}
+}
+
+// WithEnqueueTimeout sets how long a request may wait for room in a full
+// queue before it is rejected with 429 Too Many Requests.
+func WithEnqueueTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.enqueueWait = d
+	}
+}
+
+// WithStore hands the server the datastore its handler writes to, so that
+// Shutdown can flush and close it once the workers have drained.
+func WithStore(store *storage.BoltStorage) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// WithIdempotencyTTL sets how long the idempotency key of an accepted message
+// is remembered. Keys are only remembered when the server has a datastore.
+func WithIdempotencyTTL(d time.Duration) Option {
+	return func(s *Server) {
+		s.dedupTTL = d
+	}
 }
 
 // NewServer creates a new ingestion server on the given port.
 // numWorkers goroutines will concurrently consume messages using the handler.
-func NewServer(port int, numWorkers int, handler func(workerID int, msg parser.AntigravityMessage)) *Server {
+func NewServer(port int, numWorkers int, handler pipeline.Handler[parser.AntigravityMessage], opts ...Option) *Server {
 	s := &Server{
-		port:    port,
-		handler: handler,
-		msgChan: make(chan parser.AntigravityMessage, 100),
+		port:        port,
+		cfg:         pipeline.Config[parser.AntigravityMessage]{Workers: numWorkers},
+		enqueueWait: 2 * time.Second,
+		dedupTTL:    parser.DefaultDedupTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
 
-	// Spawn worker swarm
-	for i := 0; i < numWorkers; i++ {
-		workerID := i
-		go func() {
-			for msg := range s.msgChan {
-				handler(workerID, msg)
+	s.ids = newMessageIDs(s.store)
+	s.events = newHub(s.store)
+
+	// Spawn worker pool; each message the handler processes is broadcast
+	// on /events.
+	s.pool = pipeline.New(context.Background(), s.cfg,
+		func(ctx context.Context, workerID int, msg parser.AntigravityMessage) error {
+			if err := handler(ctx, workerID, msg); err != nil {
+				return err
 			}
-		}()
+			s.events.publish(EventMessage, msg.SessionID, msg)
+			return nil
+		})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /ingest", s.handleIngest)
+	mux.HandleFunc("POST /ingest/batch", s.handleIngestBatch)
+	mux.HandleFunc("POST /sessions", s.handleCreateSession)
+	mux.HandleFunc("GET /health", s.handleHealth)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	mux.HandleFunc("GET /live", s.handleLive)
+	s.routeResources(mux)
+	mux.HandleFunc("GET /export/{format}", s.withStore(s.handleExport))
+	s.routeViewer(mux)
+	s.http = &http.Server{
+		Addr:    fmt.Sprintf(":%d", s.port),
+		Handler: jsonErrors(mux),
 	}
 
 	return s
 }
 
-// Start begins listening for HTTP requests.
-func (s *Server) Start() error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/ingest", s.handleIngest)
-	mux.HandleFunc("/health", s.handleHealth)
+// Stats reports each worker's throughput.
+func (s *Server) Stats() []pipeline.WorkerStats {
+	return s.pool.Stats()
+}
 
-	addr := fmt.Sprintf(":%d", s.port)
-	return http.ListenAndServe(addr, mux)
+// Handler returns the server's HTTP routes, for mounting elsewhere or testing.
+func (s *Server) Handler() http.Handler {
+	return s.http.Handler
 }
 
-func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// Start begins listening for HTTP requests. It blocks until the server fails
+// or Shutdown is called, returning nil in the latter case.
+func (s *Server) Start() error {
+	if err := s.http.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+	return nil
+}
 
+// Shutdown stops the server gracefully: it ends the /events streams, stops
+// accepting requests and waits for those in flight, drains the queued messages through the workers, then
+// flushes and closes the datastore given to WithStore. If ctx ends first,
+// remaining messages are abandoned but the datastore is still closed.
+// Calling Shutdown again returns the first call's result.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.shutdownOnce.Do(func() {
+		var errs []error
+		// Event streams never finish on their own, so they are ended first;
+		// subscribers can catch up on reconnecting to the next server.
+		s.events.close()
+		// Requests still being handled may yet queue messages, so the pool
+		// is only closed once they have all returned.
+		if err := s.http.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop http: %w", err))
+		}
+		if err := s.pool.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("drain workers: %w", err))
+		}
+		// The workers' last events are stored before the datastore is
+		// closed.
+		s.events.stop()
+		if s.store != nil {
+			if err := s.store.Sync(); err != nil {
+				errs = append(errs, fmt.Errorf("sync datastore: %w", err))
+			}
+			if err := s.store.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close datastore: %w", err))
+			}
+		}
+		s.shutdownErr = errors.Join(errs...)
+	})
+	return s.shutdownErr
+}
+
+// Queued returns the number of messages waiting for a worker.
+func (s *Server) Queued() int {
+	return s.pool.Queued()
+}
+
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, "Failed to read body")
 		return
 	}
 	defer r.Body.Close()
 
 	var req IngestRequest
 	if err := json.Unmarshal(body, &req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("Invalid JSON: %v", err))
 		return
 	}
 
+	key := r.Header.Get(IdempotencyHeader)
+	if key != "" && !idPattern.MatchString(key) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("%s %s", IdempotencyHeader, idRule))
+		return
+	}
+
+	resp, err := s.accept(r.Context(), req, key)
+	if err != nil {
+		s.rejectIngest(w, err)
+		return
+	}
+
+	if resp.Replayed {
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// errInvalid marks an ingest request that failed validation.
+var errInvalid = errors.New("invalid message")
+
+// Limits on the optional fields of an IngestRequest.
+const (
+	maxLabelLen      = 128 // channel and thread names
+	maxMetadataKeys  = 32
+	maxMetadataKey   = 64
+	maxMetadataValue = 1024
+	// maxClockSkew is how far in the future a client timestamp may be.
+	maxClockSkew = time.Hour
+)
+
+// toMessage validates req and builds the message it describes, without a
+// message id. received is used when the request carries no timestamp.
+func toMessage(req IngestRequest, received time.Time) (parser.AntigravityMessage, error) {
+	invalid := func(format string, args ...any) (parser.AntigravityMessage, error) {
+		return parser.AntigravityMessage{}, fmt.Errorf("%w: "+format, append([]any{errInvalid}, args...)...)
+	}
+
 	msg := parser.AntigravityMessage{
-		SessionID: "live",
-		MessageID: 0,
-		Type:      req.Type,
-		User:      req.User,
-		Message:   req.Message,
-		Timestamp: time.Now(),
+		SessionID:       req.SessionID,
+		Type:            req.Type,
+		User:            req.User,
+		Message:         req.Message,
+		Timestamp:       received,
+		ClientMessageID: req.ClientMessageID,
+		ReplyTo:         req.ReplyTo,
+		Channel:         req.Channel,
+		Thread:          req.Thread,
+		Metadata:        req.Metadata,
+	}
+	if msg.SessionID == "" {
+		msg.SessionID = DefaultSession
+	}
+
+	if !idPattern.MatchString(msg.SessionID) {
+		return invalid("session id %q %s", msg.SessionID, idRule)
+	}
+	if msg.Type == "" {
+		return invalid("type is required")
+	}
+
+	if req.Timestamp != "" {
+		ts, err := time.Parse(time.RFC3339Nano, req.Timestamp)
+		if err != nil {
+			return invalid("timestamp %q is not RFC 3339", req.Timestamp)
+		}
+		if ts.After(received.Add(maxClockSkew)) {
+			return invalid("timestamp %s is in the future", req.Timestamp)
+		}
+		msg.Timestamp = ts
+	}
+
+	for _, f := range []struct{ name, value string }{
+		{"clientMessageId", msg.ClientMessageID},
+		{"replyTo", msg.ReplyTo},
+	} {
+		if f.value != "" && !idPattern.MatchString(f.value) {
+			return invalid("%s %q %s", f.name, f.value, idRule)
+		}
+	}
+	if msg.ReplyTo != "" && msg.ReplyTo == msg.ClientMessageID {
+		return invalid("message cannot reply to itself")
+	}
+	for _, f := range []struct{ name, value string }{
+		{"channel", msg.Channel},
+		{"thread", msg.Thread},
+	} {
+		if err := checkLabel(f.value, maxLabelLen); err != nil {
+			return invalid("%s: %v", f.name, err)
+		}
+	}
+
+	if len(msg.Metadata) > maxMetadataKeys {
+		return invalid("metadata has %d keys, at most %d allowed", len(msg.Metadata), maxMetadataKeys)
+	}
+	for k, v := range msg.Metadata {
+		if k == "" {
+			return invalid("metadata keys must not be empty")
+		}
+		if err := checkLabel(k, maxMetadataKey); err != nil {
+			return invalid("metadata key %q: %v", k, err)
+		}
+		if len(v) > maxMetadataValue {
+			return invalid("metadata value for %q is longer than %d bytes", k, maxMetadataValue)
+		}
+	}
+	return msg, nil
+}
+
+// checkLabel rejects names that are too long or contain control characters.
+func checkLabel(s string, maxLen int) error {
+	if len(s) > maxLen {
+		return fmt.Errorf("longer than %d bytes", maxLen)
+	}
+	if !utf8.ValidString(s) {
+		return errors.New("not valid UTF-8")
+	}
+	for _, r := range s {
+		if unicode.IsControl(r) {
+			return errors.New("contains control characters")
+		}
+	}
+	return nil
+}
+
+// accept validates req, gives it the next message id in its session and
+// queues it for the workers.
+//
+// With a datastore, a message carrying an idempotency key, or failing that a
+// client message id, is accepted only once while the key is remembered;
+// repeats get the original's ids back with Replayed set and are not queued.
+// The id given to a repeat, or to a message that could not be queued, is
+// given back to the session.
+func (s *Server) accept(ctx context.Context, req IngestRequest, idempotencyKey string) (IngestResponse, error) {
+	msg, err := toMessage(req, time.Now())
+	if err != nil {
+		return IngestResponse{}, err
+	}
+	msg.MessageID, err = s.ids.assign(msg.SessionID)
+	if err != nil {
+		return IngestResponse{}, err
+	}
+
+	key := dedupKey(msg, idempotencyKey)
+	if s.store != nil && key != "" {
+		original, err := s.store.ClaimIdempotencyKey(storage.IdempotencyRecord{
+			Key:       key,
+			SessionID: msg.SessionID,
+			MessageID: msg.MessageID,
+		}, s.dedupTTL)
+		if err != nil {
+			s.ids.release(msg.SessionID, msg.MessageID)
+			return IngestResponse{}, fmt.Errorf("claim idempotency key: %w", err)
+		}
+		if original != nil {
+			s.ids.release(msg.SessionID, msg.MessageID)
+			return IngestResponse{
+				Status:    "accepted",
+				SessionID: original.SessionID,
+				MessageID: original.MessageID,
+				Replayed:  true,
+			}, nil
+		}
+	}
+
+	if err := s.enqueue(ctx, msg); err != nil {
+		if s.store != nil && key != "" {
+			// Let the client's retry through.
+			if relErr := s.store.ReleaseIdempotencyKey(key); relErr != nil {
+				// The key still names the id, so it cannot be given back.
+				return IngestResponse{}, fmt.Errorf("%w (idempotency key not released: %v)", err, relErr)
+			}
+		}
+		s.ids.release(msg.SessionID, msg.MessageID)
+		return IngestResponse{}, err
 	}
+	return IngestResponse{Status: "accepted", SessionID: msg.SessionID, MessageID: msg.MessageID}, nil
+}
 
-	s.msgChan <- msg
+// dedupKey is the key msg is deduplicated by: the Idempotency-Key header if
+// given, otherwise its client message id within its session, or "" if it has
+// neither.
+func dedupKey(msg parser.AntigravityMessage, idempotencyKey string) string {
+	switch {
+	case idempotencyKey != "":
+		return "h:" + idempotencyKey
+	case msg.ClientMessageID != "":
+		return parser.DedupKey(msg)
+	default:
+		return ""
+	}
+}
+
+// errQueueFull means a message found no room in its queue within the
+// server's enqueue timeout.
+var errQueueFull = errors.New("ingest queue is full")
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(map[string]string{"status": "accepted"})
+// enqueue hands msg to the workers, waiting at most the enqueue timeout for
+// room in its queue.
+func (s *Server) enqueue(ctx context.Context, msg parser.AntigravityMessage) error {
+	wait, cancel := context.WithTimeout(ctx, s.enqueueWait)
+	defer cancel()
+	err := s.pool.Submit(wait, msg)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return errQueueFull
+	}
+	return err
+}
+
+// ingestStatus maps an error from accept to an HTTP status: 400 for invalid
+// messages, 429 if the queue stayed full, 503 if the server is shutting down.
+func ingestStatus(err error) int {
+	switch {
+	case errors.Is(err, errInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, errQueueFull):
+		return http.StatusTooManyRequests
+	case errors.Is(err, pipeline.ErrClosed), errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// rejectIngest answers a request whose message was not accepted. Overload
+// responses tell the client when to try again.
+func (s *Server) rejectIngest(w http.ResponseWriter, err error) {
+	status := ingestStatus(err)
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		s.setRetryAfter(w)
+	}
+	writeError(w, status, ingestErrorText(status, err))
+}
+
+// ingestErrorText describes an error from accept that was given status.
+func ingestErrorText(status int, err error) string {
+	switch status {
+	case http.StatusBadRequest:
+		return err.Error()
+	case http.StatusTooManyRequests:
+		return "Ingest queue is full, retry later"
+	case http.StatusServiceUnavailable:
+		return "Server is shutting down"
+	default:
+		return "Failed to ingest message"
+	}
+}
+
+func (s *Server) setRetryAfter(w http.ResponseWriter) {
+	retry := max(1, int(math.Ceil(s.enqueueWait.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(retry))
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	queued, capacity := s.pool.Queued(), s.pool.Capacity()
+	status := "ok"
+	if queued >= capacity {
+		status = "saturated"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"status": status,
+		"queue": map[string]int{
+			"depth":    queued,
+			"capacity": capacity,
+		},
+		"workers": s.pool.Stats(),
+	})
 }
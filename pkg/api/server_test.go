@@ -0,0 +1,284 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// ingest posts body to the server's /ingest route and returns the response.
+func ingest(server *api.Server, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	server.Handler().ServeHTTP(rec, req)
+	return rec
+}
+
+var _ = Describe("Server Shutdown", func() {
+	It("drains queued messages and closes the datastore", func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "serve.db"))
+		Expect(err).NotTo(HaveOccurred())
+
+		var handled atomic.Int32
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			time.Sleep(5 * time.Millisecond)
+			handled.Add(1)
+			return store.AppendMessage(&msg)
+		}
+		server := api.NewServer(0, 1, handler, api.WithStore(store))
+
+		started := make(chan error, 1)
+		go func() { started <- server.Start() }()
+
+		for i := 0; i < 10; i++ {
+			Expect(ingest(server, `{"type":"user","message":"hi"}`).Code).To(Equal(http.StatusAccepted))
+		}
+
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		Expect(handled.Load()).To(BeEquivalentTo(10))
+		Eventually(started).Should(Receive(BeNil()))
+
+		// The datastore has been closed.
+		_, err = store.ListSessions()
+		Expect(err).To(HaveOccurred())
+
+		Expect(ingest(server, `{"type":"user","message":"late"}`).Code).To(Equal(http.StatusServiceUnavailable))
+	})
+
+	It("gives up draining when its context ends", func() {
+		release := make(chan struct{})
+		defer close(release)
+		handler := func(ctx context.Context, _ int, _ parser.AntigravityMessage) error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-release:
+				return nil
+			}
+		}
+		server := api.NewServer(0, 1, handler)
+		Expect(ingest(server, `{"type":"user","message":"stuck"}`).Code).To(Equal(http.StatusAccepted))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		Expect(server.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+	})
+})
+
+var _ = Describe("Ingest Backpressure", func() {
+	var (
+		server  *api.Server
+		release chan struct{}
+	)
+
+	BeforeEach(func() {
+		release = make(chan struct{})
+		handler := func(ctx context.Context, _ int, _ parser.AntigravityMessage) error {
+			select {
+			case <-ctx.Done():
+			case <-release:
+			}
+			return nil
+		}
+		server = api.NewServer(0, 1, handler,
+			api.WithQueueDepth(1),
+			api.WithEnqueueTimeout(10*time.Millisecond))
+	})
+
+	AfterEach(func() {
+		close(release)
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	It("turns requests away with 429 and Retry-After once the queue is full", func() {
+		// One message occupies the worker, the next fills the queue.
+		Expect(ingest(server, `{"type":"user","message":"1"}`).Code).To(Equal(http.StatusAccepted))
+		Eventually(server.Queued).Should(BeZero())
+		Expect(ingest(server, `{"type":"user","message":"2"}`).Code).To(Equal(http.StatusAccepted))
+
+		rec := ingest(server, `{"type":"user","message":"3"}`)
+		Expect(rec.Code).To(Equal(http.StatusTooManyRequests))
+		Expect(rec.Header().Get("Retry-After")).To(Equal("1"))
+
+		health := httptest.NewRecorder()
+		server.Handler().ServeHTTP(health, httptest.NewRequest(http.MethodGet, "/health", nil))
+		Expect(health.Body.String()).To(ContainSubstring(`"status":"saturated"`))
+		Expect(health.Body.String()).To(ContainSubstring(`"queue":{"capacity":1,"depth":1}`))
+	})
+
+	It("gives the id of a turned away message to the next one", func() {
+		id := func(rec *httptest.ResponseRecorder) int {
+			var resp api.IngestResponse
+			Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+			return resp.MessageID
+		}
+		Expect(id(ingest(server, `{"sessionId":"s","type":"user","message":"1"}`))).To(Equal(0))
+		Eventually(server.Queued).Should(BeZero())
+		Expect(id(ingest(server, `{"sessionId":"s","type":"user","message":"2"}`))).To(Equal(1))
+		Expect(ingest(server, `{"sessionId":"s","type":"user","message":"3"}`).Code).To(Equal(http.StatusTooManyRequests))
+
+		// Free the worker so the queued message makes room.
+		release <- struct{}{}
+		Eventually(server.Queued).Should(BeZero())
+		Expect(id(ingest(server, `{"sessionId":"s","type":"user","message":"3"}`))).To(Equal(2))
+	})
+})
+
+var _ = Describe("Ingest Validation", func() {
+	var (
+		server   *api.Server
+		received chan parser.AntigravityMessage
+	)
+
+	BeforeEach(func() {
+		received = make(chan parser.AntigravityMessage, 10)
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			received <- msg
+			return nil
+		}
+		server = api.NewServer(0, 1, handler)
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	It("carries client timestamps and context through to the handler", func() {
+		rec := ingest(server, `{
+			"sessionId": "s", "type": "user", "user": "ana", "message": "hi",
+			"timestamp": "2024-03-01T09:30:00.1234567-05:00",
+			"clientMessageId": "c-2", "replyTo": "c-1",
+			"channel": "#design", "thread": "graph layout",
+			"metadata": {"client": "ag-forward"}
+		}`)
+		Expect(rec.Code).To(Equal(http.StatusAccepted), rec.Body.String())
+
+		var msg parser.AntigravityMessage
+		Eventually(received).Should(Receive(&msg))
+		Expect(msg.Timestamp.UTC()).To(Equal(time.Date(2024, 3, 1, 14, 30, 0, 123456700, time.UTC)))
+		Expect(msg.ClientMessageID).To(Equal("c-2"))
+		Expect(msg.ReplyTo).To(Equal("c-1"))
+		Expect(msg.Channel).To(Equal("#design"))
+		Expect(msg.Thread).To(Equal("graph layout"))
+		Expect(msg.Metadata).To(Equal(map[string]string{"client": "ag-forward"}))
+	})
+
+	It("stamps messages without a timestamp with the time received", func() {
+		before := time.Now()
+		Expect(ingest(server, `{"type":"user","message":"now"}`).Code).To(Equal(http.StatusAccepted))
+		var msg parser.AntigravityMessage
+		Eventually(received).Should(Receive(&msg))
+		Expect(msg.Timestamp).To(BeTemporally(">=", before))
+	})
+
+	DescribeTable("rejects malformed values with 400",
+		func(body, reason string) {
+			rec := ingest(server, body)
+			Expect(rec.Code).To(Equal(http.StatusBadRequest))
+			Expect(rec.Body.String()).To(ContainSubstring(reason))
+		},
+		Entry("bad timestamp", `{"type":"user","timestamp":"yesterday"}`, "RFC 3339"),
+		Entry("future timestamp", `{"type":"user","timestamp":"2999-01-01T00:00:00Z"}`, "in the future"),
+		Entry("bad client id", `{"type":"user","clientMessageId":"has space"}`, "clientMessageId"),
+		Entry("self reply", `{"type":"user","clientMessageId":"a","replyTo":"a"}`, "reply to itself"),
+		Entry("control characters", `{"type":"user","channel":"a\u0007b"}`, "control characters"),
+		Entry("non-string metadata", `{"type":"user","metadata":{"n":1}}`, "Invalid JSON"),
+		Entry("empty metadata key", `{"type":"user","metadata":{"":"x"}}`, "must not be empty"),
+	)
+})
+
+var _ = Describe("Ingest Idempotency", func() {
+	var (
+		server  *api.Server
+		handled atomic.Int32
+	)
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "idempotency.db"))
+		Expect(err).NotTo(HaveOccurred())
+		handled.Store(0)
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			handled.Add(1)
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 2, handler, api.WithStore(store))
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	post := func(key, body string) (*httptest.ResponseRecorder, api.IngestResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(body))
+		if key != "" {
+			req.Header.Set(api.IdempotencyHeader, key)
+		}
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+		var resp api.IngestResponse
+		json.Unmarshal(rec.Body.Bytes(), &resp)
+		return rec, resp
+	}
+
+	It("answers a repeated Idempotency-Key with the original result", func() {
+		rec, first := post("retry-1", `{"sessionId":"s","type":"user","message":"hi"}`)
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		Expect(first.Replayed).To(BeFalse())
+
+		rec, again := post("retry-1", `{"sessionId":"s","type":"user","message":"hi"}`)
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		Expect(rec.Header().Get("Idempotent-Replayed")).To(Equal("true"))
+		Expect(again.Replayed).To(BeTrue())
+		Expect(again.MessageID).To(Equal(first.MessageID))
+
+		// The repeat used up no id.
+		_, other := post("retry-2", `{"sessionId":"s","type":"user","message":"hi"}`)
+		Expect(other.Replayed).To(BeFalse())
+		Expect(other.MessageID).To(Equal(first.MessageID + 1))
+
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+		Expect(handled.Load()).To(BeEquivalentTo(2))
+	})
+
+	It("deduplicates by client message id within a session", func() {
+		_, first := post("", `{"sessionId":"s","type":"user","clientMessageId":"m-1"}`)
+		_, again := post("", `{"sessionId":"s","type":"user","clientMessageId":"m-1"}`)
+		Expect(again.Replayed).To(BeTrue())
+		Expect(again.MessageID).To(Equal(first.MessageID))
+
+		_, elsewhere := post("", `{"sessionId":"t","type":"user","clientMessageId":"m-1"}`)
+		Expect(elsewhere.Replayed).To(BeFalse())
+	})
+
+	It("deduplicates batch items by client message id", func() {
+		body := `{"sessionId":"s","type":"user","clientMessageId":"b-1"}` + "\n" +
+			`{"sessionId":"s","type":"user","clientMessageId":"b-1"}` + "\n"
+		req := httptest.NewRequest(http.MethodPost, "/ingest/batch", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, req)
+
+		var resp api.BatchResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		Expect(resp.Accepted).To(Equal(2))
+		Expect(resp.Results[1].Replayed).To(BeTrue())
+		Expect(*resp.Results[1].MessageID).To(Equal(*resp.Results[0].MessageID))
+	})
+
+	It("rejects a malformed Idempotency-Key", func() {
+		rec, _ := post("has space", `{"type":"user"}`)
+		Expect(rec.Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sync"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// DefaultSession is the session for ingested messages that do not name one.
+const DefaultSession = "live"
+
+// idPattern restricts client-chosen ids, such as session and client message
+// ids, to characters that are safe in URLs and as storage keys.
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// idRule describes idPattern in error messages.
+const idRule = "must be 1-128 letters, digits, '.', '_', ':' or '-'"
+
+// messageIDs hands out message ids, increasing by one within each session.
+// A session's counter starts after the highest id already in the datastore,
+// so ids keep increasing across restarts.
+type messageIDs struct {
+	mu    sync.Mutex
+	next  map[string]int
+	store *storage.BoltStorage
+}
+
+func newMessageIDs(store *storage.BoltStorage) *messageIDs {
+	return &messageIDs{next: map[string]int{}, store: store}
+}
+
+// assign returns the next message id for session.
+func (a *messageIDs) assign(session string) (int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	id, ok := a.next[session]
+	if !ok && a.store != nil {
+		last, err := a.store.LastMessageID(session)
+		if err != nil {
+			return 0, fmt.Errorf("look up session %s: %w", session, err)
+		}
+		id = last + 1
+	}
+	a.next[session] = id + 1
+	return id, nil
+}
+
+// release gives back an id whose message was not accepted, so that the next
+// message in session gets it. Only the latest id can be given back; an older
+// one stays unused rather than be handed out twice.
+func (a *messageIDs) release(session string, id int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.next[session] == id+1 {
+		a.next[session] = id
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// handleCreateSession starts a session with a server-chosen id, for clients
+// that have no natural id of their own. With a datastore the session is
+// stored straight away, so it is listed and readable before its first
+// message; its ids, like any session's, are then looked up from there.
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	id, err := newSessionID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "Failed to create session")
+		return
+	}
+	if s.store != nil {
+		if err := s.store.CreateSession(id); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{"sessionId": id})
+}
@@ -0,0 +1,96 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Session and Message IDs", func() {
+	var (
+		store  *storage.BoltStorage
+		server *api.Server
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "ids.db"))
+		Expect(err).NotTo(HaveOccurred())
+
+		// A previous run already stored messages 0..2 of "resumed".
+		for id := 0; id < 3; id++ {
+			Expect(store.SaveMessage(parser.AntigravityMessage{SessionID: "resumed", MessageID: id})).To(Succeed())
+		}
+
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 2, handler, api.WithStore(store))
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	accepted := func(body string) api.IngestResponse {
+		rec := ingest(server, body)
+		Expect(rec.Code).To(Equal(http.StatusAccepted), rec.Body.String())
+		var resp api.IngestResponse
+		Expect(json.Unmarshal(rec.Body.Bytes(), &resp)).To(Succeed())
+		return resp
+	}
+
+	It("numbers each session's messages independently", func() {
+		Expect(accepted(`{"sessionId":"a","type":"user","message":"1"}`).MessageID).To(Equal(0))
+		Expect(accepted(`{"sessionId":"a","type":"user","message":"2"}`).MessageID).To(Equal(1))
+		Expect(accepted(`{"sessionId":"b","type":"user","message":"1"}`).MessageID).To(Equal(0))
+
+		resp := accepted(`{"type":"user","message":"no session"}`)
+		Expect(resp.SessionID).To(Equal(api.DefaultSession))
+		Expect(resp.MessageID).To(Equal(0))
+	})
+
+	It("continues after the ids already in the datastore", func() {
+		Expect(accepted(`{"sessionId":"resumed","type":"user","message":"next"}`).MessageID).To(Equal(3))
+	})
+
+	It("rejects session ids that are not URL and key safe", func() {
+		Expect(ingest(server, `{"sessionId":"a/b","type":"user","message":"x"}`).Code).To(Equal(http.StatusBadRequest))
+	})
+
+	It("creates sessions with generated ids", func() {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/sessions", nil))
+		Expect(rec.Code).To(Equal(http.StatusCreated))
+
+		var created struct {
+			SessionID string `json:"sessionId"`
+		}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &created)).To(Succeed())
+		Expect(created.SessionID).NotTo(BeEmpty())
+
+		// The new session is stored before its first message.
+		get := func(target string) *httptest.ResponseRecorder {
+			rec := httptest.NewRecorder()
+			server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+			return rec
+		}
+		rec = get("/sessions/" + created.SessionID + "/messages")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Body.String()).To(ContainSubstring(`"items":[]`))
+		Expect(get("/sessions").Body.String()).To(ContainSubstring(created.SessionID))
+		Expect(get("/sessions/unknown/messages").Code).To(Equal(http.StatusNotFound))
+
+		resp := accepted(`{"sessionId":"` + created.SessionID + `","type":"user","message":"first"}`)
+		Expect(resp.MessageID).To(Equal(0))
+	})
+})
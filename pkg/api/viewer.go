@@ -0,0 +1,132 @@
+package api
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+	"github.com/gnomatix/enkente/pkg/theme"
+)
+
+const (
+	// defaultTimelineSize and maxTimelineSize bound the limit query
+	// parameter of /graph.
+	defaultTimelineSize = 500
+	maxTimelineSize     = 5000
+)
+
+// webFS holds the mind-map viewer served under /ui/.
+//
+//go:embed web
+var webFS embed.FS
+
+// GraphSnapshot is what the viewer draws: the concept graph, the latest
+// messages, and the colors to show participants in.
+type GraphSnapshot struct {
+	Concepts []storage.Concept `json:"concepts"`
+	Edges    []storage.Edge    `json:"edges"`
+	// Messages are the latest messages, oldest first.
+	Messages []TimelineMessage `json:"messages"`
+	// Palette and SystemColor are theme.AllUserColors and
+	// theme.SystemColor, so that the viewer can color participants it
+	// first sees in live events the same way.
+	Palette     []string `json:"palette"`
+	SystemColor string   `json:"systemColor"`
+	// LastEventID is the event the snapshot is current to; the viewer
+	// follows /events from there.
+	LastEventID uint64 `json:"lastEventId"`
+}
+
+// TimelineMessage is a message with the color of its sender.
+type TimelineMessage struct {
+	parser.AntigravityMessage
+	Color string `json:"color"`
+}
+
+// routeViewer registers the web viewer and the snapshot it loads.
+func (s *Server) routeViewer(mux *http.ServeMux) {
+	static, err := fs.Sub(webFS, "web")
+	if err != nil {
+		panic(err)
+	}
+	mux.Handle("GET /ui/", http.StripPrefix("/ui/", http.FileServerFS(static)))
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/ui/", http.StatusFound)
+	})
+	mux.HandleFunc("GET /graph", s.withStore(s.handleGraph))
+}
+
+// handleGraph returns a GraphSnapshot. Repeating the session query parameter
+// limits the timeline to those sessions, and limit caps its length.
+func (s *Server) handleGraph(w http.ResponseWriter, r *http.Request) {
+	limit := defaultTimelineSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxTimelineSize {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxTimelineSize))
+			return
+		}
+		limit = n
+	}
+
+	// The event id is read first so that a change racing with the snapshot
+	// is sent again rather than missed.
+	lastID, err := s.store.LastEventID()
+	if err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	snap := GraphSnapshot{LastEventID: lastID, SystemColor: string(theme.SystemColor)}
+	for _, c := range theme.AllUserColors() {
+		snap.Palette = append(snap.Palette, string(c))
+	}
+
+	if snap.Concepts, err = s.store.ListConcepts(); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+	if snap.Edges, err = s.store.ListEdges(); err != nil {
+		writeStorageError(w, err)
+		return
+	}
+
+	sessions := r.URL.Query()["session"]
+	if len(sessions) == 0 {
+		if sessions, err = s.store.ListSessions(); err != nil {
+			writeStorageError(w, err)
+			return
+		}
+	}
+	// Only the latest limit messages of each session can make the cut.
+	var msgs []parser.AntigravityMessage
+	for _, id := range sessions {
+		m, err := s.store.LatestMessages(id, limit)
+		if err != nil {
+			writeStorageError(w, err)
+			return
+		}
+		msgs = append(msgs, m...)
+	}
+	slices.SortStableFunc(msgs, func(a, b parser.AntigravityMessage) int {
+		return a.Timestamp.Compare(b.Timestamp)
+	})
+	if len(msgs) > limit {
+		msgs = msgs[len(msgs)-limit:]
+	}
+	snap.Messages = make([]TimelineMessage, len(msgs))
+	for i, m := range msgs {
+		snap.Messages[i] = TimelineMessage{AntigravityMessage: m, Color: string(theme.UserColor(m.User, m.Type))}
+	}
+	if snap.Concepts == nil {
+		snap.Concepts = []storage.Concept{}
+	}
+	if snap.Edges == nil {
+		snap.Edges = []storage.Edge{}
+	}
+
+	writeJSON(w, http.StatusOK, snap)
+}
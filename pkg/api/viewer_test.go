@@ -0,0 +1,114 @@
+package api_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/api"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+	"github.com/gnomatix/enkente/pkg/theme"
+)
+
+var _ = Describe("Web Viewer", func() {
+	var (
+		server *api.Server
+		store  *storage.BoltStorage
+	)
+
+	BeforeEach(func() {
+		var err error
+		store, err = storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "viewer.db"))
+		Expect(err).NotTo(HaveOccurred())
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			return store.SaveMessage(msg)
+		}
+		server = api.NewServer(0, 1, handler, api.WithStore(store))
+	})
+
+	AfterEach(func() {
+		Expect(server.Shutdown(context.Background())).To(Succeed())
+	})
+
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		return rec
+	}
+
+	It("serves the embedded app", func() {
+		rec := get("/")
+		Expect(rec.Code).To(Equal(http.StatusFound))
+		Expect(rec.Header().Get("Location")).To(Equal("/ui/"))
+
+		rec = get("/ui/")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(rec.Header().Get("Content-Type")).To(HavePrefix("text/html"))
+		Expect(rec.Body.String()).To(ContainSubstring(`<script src="app.js">`))
+
+		for _, asset := range []string{"/ui/app.js", "/ui/style.css"} {
+			Expect(get(asset).Code).To(Equal(http.StatusOK), asset)
+		}
+		Expect(get("/ui/missing.js").Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("returns a snapshot of the graph and timeline", func() {
+		Expect(store.CreateConcept(&storage.Concept{ID: "a", Label: "alpha"})).To(Succeed())
+		Expect(store.CreateConcept(&storage.Concept{ID: "b", Label: "beta"})).To(Succeed())
+		Expect(store.CreateEdge(&storage.Edge{ID: "e", From: "a", To: "b", Relation: "uses"})).To(Succeed())
+		start := time.Now()
+		for i, m := range []parser.AntigravityMessage{
+			{SessionID: "s2", MessageID: 0, Type: "user", User: "bob", Message: "second", Timestamp: start.Add(time.Second)},
+			{SessionID: "s1", MessageID: 0, Type: "user", User: "alice", Message: "first", Timestamp: start},
+			{SessionID: "s1", MessageID: 1, Type: "system", Message: "third", Timestamp: start.Add(2 * time.Second)},
+		} {
+			Expect(store.SaveMessage(m)).To(Succeed(), "message %d", i)
+		}
+		Expect(store.AppendEvent(&storage.Event{Type: api.EventMessage, Data: json.RawMessage(`{}`)})).To(Succeed())
+
+		rec := get("/graph")
+		Expect(rec.Code).To(Equal(http.StatusOK), rec.Body.String())
+		var snap api.GraphSnapshot
+		Expect(json.Unmarshal(rec.Body.Bytes(), &snap)).To(Succeed())
+
+		Expect(snap.Concepts).To(HaveLen(2))
+		Expect(snap.Edges).To(HaveLen(1))
+		Expect(snap.LastEventID).To(BeEquivalentTo(1))
+		Expect(snap.Palette).To(HaveLen(len(theme.AllUserColors())))
+		Expect(snap.SystemColor).To(Equal(string(theme.SystemColor)))
+
+		var texts []string
+		for _, m := range snap.Messages {
+			texts = append(texts, m.Message)
+		}
+		Expect(texts).To(Equal([]string{"first", "second", "third"}))
+		Expect(snap.Messages[0].Color).To(Equal(string(theme.UserColor("alice", "user"))))
+		Expect(snap.Messages[2].Color).To(Equal(string(theme.SystemColor)))
+	})
+
+	It("limits the timeline to the requested sessions and length", func() {
+		for i := 0; i < 3; i++ {
+			Expect(store.SaveMessage(parser.AntigravityMessage{SessionID: "s1", MessageID: i, Type: "user", Timestamp: time.Now()})).To(Succeed())
+			Expect(store.SaveMessage(parser.AntigravityMessage{SessionID: "s2", MessageID: i, Type: "user", Timestamp: time.Now()})).To(Succeed())
+		}
+
+		var snap api.GraphSnapshot
+		rec := get("/graph?session=s2&limit=2")
+		Expect(rec.Code).To(Equal(http.StatusOK))
+		Expect(json.Unmarshal(rec.Body.Bytes(), &snap)).To(Succeed())
+		Expect(snap.Messages).To(HaveLen(2))
+		for _, m := range snap.Messages {
+			Expect(m.SessionID).To(Equal("s2"))
+		}
+		Expect(snap.Concepts).NotTo(BeNil())
+
+		Expect(get("/graph?limit=0").Code).To(Equal(http.StatusBadRequest))
+	})
+})
@@ -0,0 +1,362 @@
+// enkente mind-map viewer: draws the concept graph with a force-directed
+// layout beside a timeline of messages, and keeps both current from the
+// /events stream.
+"use strict";
+
+const SVG_NS = "http://www.w3.org/2000/svg";
+const MAX_MESSAGES = 500;
+
+const state = {
+  nodes: new Map(), // concept id -> {concept, x, y, vx, vy, el}
+  edges: new Map(), // edge id -> {edge, el}
+  palette: [],
+  systemColor: "#7294D4",
+  lastEventId: 0,
+  shown: new Set(), // "session/messageId" of the messages in the timeline
+  alpha: 0,
+  view: { x: 0, y: 0, scale: 1 },
+};
+
+const el = {
+  svg: document.getElementById("graph"),
+  viewport: document.getElementById("viewport"),
+  edges: document.getElementById("edges"),
+  nodes: document.getElementById("nodes"),
+  empty: document.getElementById("empty"),
+  messages: document.getElementById("messages"),
+  status: document.getElementById("status"),
+  counts: document.getElementById("counts"),
+};
+
+// userColor mirrors theme.UserColor: a 64-bit hash*31 + code point over the
+// user's name, or the message type, indexing the palette.
+function userColor(user, type) {
+  if (type === "system" || state.palette.length === 0) {
+    return state.systemColor;
+  }
+  const identity = user || type || "";
+  let hash = 0n;
+  for (const ch of identity) {
+    hash = BigInt.asUintN(64, hash * 31n + BigInt(ch.codePointAt(0)));
+  }
+  return state.palette[Number(hash % BigInt(state.palette.length))];
+}
+
+function svg(name, attrs = {}) {
+  const node = document.createElementNS(SVG_NS, name);
+  for (const [k, v] of Object.entries(attrs)) {
+    node.setAttribute(k, v);
+  }
+  return node;
+}
+
+// --- Graph -----------------------------------------------------------------
+
+function upsertConcept(concept, fresh) {
+  let node = state.nodes.get(concept.id);
+  if (!node) {
+    const { width, height } = el.svg.getBoundingClientRect();
+    const angle = Math.random() * 2 * Math.PI;
+    const r = 50 + Math.random() * 50;
+    node = {
+      x: (width || 800) / 2 + Math.cos(angle) * r,
+      y: (height || 600) / 2 + Math.sin(angle) * r,
+      vx: 0,
+      vy: 0,
+      el: svg("g"),
+    };
+    node.el.append(svg("circle", { r: 8 }), svg("text", { dx: 12, dy: 4 }));
+    node.el.append(svg("title"));
+    enableDrag(node);
+    el.nodes.append(node.el);
+    state.nodes.set(concept.id, node);
+  }
+  node.concept = concept;
+  node.el.querySelector("text").textContent = concept.label;
+  const details = [concept.label];
+  if (concept.kind) details.push(`kind: ${concept.kind}`);
+  if (concept.aliases && concept.aliases.length) details.push(`aka ${concept.aliases.join(", ")}`);
+  if (concept.provenance && concept.provenance.user) details.push(`from ${concept.provenance.user}`);
+  node.el.querySelector("title").textContent = details.join("\n");
+  if (fresh) {
+    node.el.classList.add("fresh");
+    setTimeout(() => node.el.classList.remove("fresh"), 2000);
+  }
+  reheat();
+}
+
+function removeConcept(id) {
+  const node = state.nodes.get(id);
+  if (!node) return;
+  node.el.remove();
+  state.nodes.delete(id);
+  for (const [edgeId, e] of state.edges) {
+    if (e.edge.from === id || e.edge.to === id) removeEdge(edgeId);
+  }
+  reheat();
+}
+
+function upsertEdge(edge) {
+  let e = state.edges.get(edge.id);
+  if (!e) {
+    e = { el: svg("g") };
+    e.el.append(svg("line", { "marker-end": "url(#arrow)" }), svg("text"));
+    el.edges.append(e.el);
+    state.edges.set(edge.id, e);
+  }
+  e.edge = edge;
+  e.el.querySelector("text").textContent = edge.relation;
+  e.el.querySelector("line").setAttribute("stroke-width", 1 + Math.min(edge.weight || 0, 4));
+  reheat();
+}
+
+function removeEdge(id) {
+  const e = state.edges.get(id);
+  if (!e) return;
+  e.el.remove();
+  state.edges.delete(id);
+  reheat();
+}
+
+function reheat() {
+  const wasCold = state.alpha < 0.01;
+  state.alpha = Math.max(state.alpha, 0.5);
+  el.empty.hidden = state.nodes.size > 0;
+  el.counts.textContent = `${state.nodes.size} concepts · ${state.edges.size} edges`;
+  if (wasCold) requestAnimationFrame(tick);
+}
+
+// tick advances the simulation one step: every pair of concepts repels,
+// every edge pulls its ends together, and everything drifts to the centre.
+function tick() {
+  const nodes = [...state.nodes.values()];
+  const { width, height } = el.svg.getBoundingClientRect();
+  const cx = (width || 800) / 2;
+  const cy = (height || 600) / 2;
+  const alpha = state.alpha;
+
+  for (let i = 0; i < nodes.length; i++) {
+    const a = nodes[i];
+    for (let j = i + 1; j < nodes.length; j++) {
+      const b = nodes[j];
+      let dx = a.x - b.x;
+      let dy = a.y - b.y;
+      let d2 = dx * dx + dy * dy;
+      if (d2 < 1) {
+        dx = Math.random() - 0.5;
+        dy = Math.random() - 0.5;
+        d2 = 1;
+      }
+      const f = (900 * alpha) / d2;
+      a.vx += dx * f;
+      a.vy += dy * f;
+      b.vx -= dx * f;
+      b.vy -= dy * f;
+    }
+  }
+  for (const { edge } of state.edges.values()) {
+    const a = state.nodes.get(edge.from);
+    const b = state.nodes.get(edge.to);
+    if (!a || !b || a === b) continue;
+    const dx = b.x - a.x;
+    const dy = b.y - a.y;
+    const d = Math.sqrt(dx * dx + dy * dy) || 1;
+    const f = ((d - 90) / d) * 0.05 * alpha;
+    a.vx += dx * f;
+    a.vy += dy * f;
+    b.vx -= dx * f;
+    b.vy -= dy * f;
+  }
+  for (const n of nodes) {
+    n.vx += (cx - n.x) * 0.01 * alpha;
+    n.vy += (cy - n.y) * 0.01 * alpha;
+    if (!n.dragging) {
+      n.x += n.vx;
+      n.y += n.vy;
+    }
+    n.vx *= 0.6;
+    n.vy *= 0.6;
+  }
+
+  draw();
+  state.alpha *= 0.985;
+  if (state.alpha >= 0.01) requestAnimationFrame(tick);
+}
+
+function draw() {
+  for (const n of state.nodes.values()) {
+    n.el.setAttribute("transform", `translate(${n.x.toFixed(1)},${n.y.toFixed(1)})`);
+  }
+  for (const { edge, el: g } of state.edges.values()) {
+    const a = state.nodes.get(edge.from);
+    const b = state.nodes.get(edge.to);
+    g.hidden = !a || !b;
+    if (!a || !b) continue;
+    const line = g.querySelector("line");
+    line.setAttribute("x1", a.x);
+    line.setAttribute("y1", a.y);
+    line.setAttribute("x2", b.x);
+    line.setAttribute("y2", b.y);
+    const label = g.querySelector("text");
+    label.setAttribute("x", (a.x + b.x) / 2);
+    label.setAttribute("y", (a.y + b.y) / 2 - 4);
+  }
+  const { x, y, scale } = state.view;
+  el.viewport.setAttribute("transform", `translate(${x},${y}) scale(${scale})`);
+}
+
+// toGraph converts a pointer position to graph coordinates.
+function toGraph(evt) {
+  const rect = el.svg.getBoundingClientRect();
+  const { x, y, scale } = state.view;
+  return { x: (evt.clientX - rect.left - x) / scale, y: (evt.clientY - rect.top - y) / scale };
+}
+
+function enableDrag(node) {
+  node.el.addEventListener("pointerdown", (evt) => {
+    evt.stopPropagation();
+    node.dragging = true;
+    node.el.setPointerCapture(evt.pointerId);
+  });
+  node.el.addEventListener("pointermove", (evt) => {
+    if (!node.dragging) return;
+    Object.assign(node, toGraph(evt));
+    reheat();
+  });
+  node.el.addEventListener("pointerup", () => {
+    node.dragging = false;
+  });
+}
+
+function enablePanZoom() {
+  let pan = null;
+  el.svg.addEventListener("pointerdown", (evt) => {
+    pan = { x: evt.clientX - state.view.x, y: evt.clientY - state.view.y };
+    el.svg.classList.add("panning");
+  });
+  el.svg.addEventListener("pointermove", (evt) => {
+    if (!pan) return;
+    state.view.x = evt.clientX - pan.x;
+    state.view.y = evt.clientY - pan.y;
+    draw();
+  });
+  const stop = () => {
+    pan = null;
+    el.svg.classList.remove("panning");
+  };
+  el.svg.addEventListener("pointerup", stop);
+  el.svg.addEventListener("pointerleave", stop);
+  el.svg.addEventListener("wheel", (evt) => {
+    evt.preventDefault();
+    const before = toGraph(evt);
+    state.view.scale = Math.min(4, Math.max(0.2, state.view.scale * Math.exp(-evt.deltaY * 0.001)));
+    const rect = el.svg.getBoundingClientRect();
+    state.view.x = evt.clientX - rect.left - before.x * state.view.scale;
+    state.view.y = evt.clientY - rect.top - before.y * state.view.scale;
+    draw();
+  }, { passive: false });
+}
+
+// --- Timeline ----------------------------------------------------------------
+
+function addMessage(msg, color) {
+  // An event racing with the snapshot can repeat a message it holds.
+  const key = `${msg.sessionId}/${msg.messageId}`;
+  if (state.shown.has(key)) return;
+  state.shown.add(key);
+
+  const item = document.createElement("li");
+  const meta = document.createElement("div");
+  meta.className = "meta";
+  const when = new Date(msg.timestamp);
+  meta.textContent = `${when.toLocaleTimeString()} · ${msg.sessionId} #${msg.messageId}`;
+  const sender = document.createElement("span");
+  sender.className = "sender";
+  sender.textContent = `${msg.user || msg.type}: `;
+  const body = document.createElement("span");
+  body.className = "body";
+  body.textContent = msg.message;
+  sender.style.color = body.style.color = color || userColor(msg.user, msg.type);
+  item.append(meta, sender, body);
+
+  // Messages arrive roughly in order; place late ones by timestamp.
+  let before = null;
+  for (let node = el.messages.lastElementChild; node; node = node.previousElementSibling) {
+    if (Number(node.dataset.at) <= when.getTime()) break;
+    before = node;
+  }
+  item.dataset.at = when.getTime();
+  el.messages.insertBefore(item, before);
+  item.dataset.key = key;
+  while (el.messages.children.length > MAX_MESSAGES) {
+    state.shown.delete(el.messages.firstElementChild.dataset.key);
+    el.messages.firstElementChild.remove();
+  }
+  if (!before) item.scrollIntoView({ block: "end" });
+}
+
+// --- Data --------------------------------------------------------------------
+
+function sessionQuery() {
+  const params = new URLSearchParams(location.search);
+  const out = new URLSearchParams();
+  for (const s of params.getAll("session")) out.append("session", s);
+  return out;
+}
+
+async function loadSnapshot() {
+  const resp = await fetch(`../graph?${sessionQuery()}`);
+  if (!resp.ok) {
+    const body = await resp.json().catch(() => ({}));
+    throw new Error(body.error || resp.statusText);
+  }
+  const snap = await resp.json();
+  state.palette = snap.palette || [];
+  state.systemColor = snap.systemColor || state.systemColor;
+  state.lastEventId = snap.lastEventId || 0;
+  for (const c of snap.concepts) upsertConcept(c, false);
+  for (const e of snap.edges) upsertEdge(e);
+  for (const m of snap.messages) addMessage(m, m.color);
+}
+
+const handlers = {
+  "message": (msg) => addMessage(msg),
+  "concept.created": (c) => upsertConcept(c, true),
+  "concept.updated": (c) => upsertConcept(c, true),
+  "concept.deleted": ({ id }) => removeConcept(id),
+  "concept.merged": (result) => {
+    for (const id of result.deleted || []) removeEdge(id);
+    removeConcept(result.removed);
+    upsertConcept(result.concept, true);
+    for (const e of result.updated || []) upsertEdge(e);
+  },
+  "edge.created": upsertEdge,
+  "edge.updated": upsertEdge,
+  "edge.deleted": ({ id }) => removeEdge(id),
+};
+
+function follow() {
+  const query = sessionQuery();
+  if (state.lastEventId) query.set("lastEventId", state.lastEventId);
+  const source = new EventSource(`../events?${query}`);
+  source.onopen = () => setStatus("live", "live");
+  source.onerror = () => setStatus("reconnecting…", "down");
+  for (const [type, handle] of Object.entries(handlers)) {
+    source.addEventListener(type, (evt) => {
+      handle(JSON.parse(evt.data));
+    });
+  }
+}
+
+function setStatus(text, cls) {
+  el.status.textContent = text;
+  el.status.className = `status ${cls || ""}`;
+}
+
+enablePanZoom();
+loadSnapshot()
+  .catch((err) => setStatus(`snapshot unavailable: ${err.message}`, "down"))
+  .finally(() => {
+    reheat();
+    follow();
+  });
@@ -0,0 +1,318 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// This file implements the server side of the WebSocket protocol (RFC 6455)
+// as far as the API needs it: the opening handshake, masked client frames,
+// fragmented messages, ping/pong and the closing handshake. Extensions and
+// subprotocols are not negotiated.
+
+// websocketGUID is appended to the client's key to form the accept key.
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// WebSocket close codes.
+const (
+	closeNormal          = 1000
+	closeGoingAway       = 1001
+	closeProtocolError   = 1002
+	closeUnsupportedData = 1003
+	closeInvalidPayload  = 1007
+	closePolicyViolation = 1008
+	closeTooBig          = 1009
+	closeInternalError   = 1011
+	closeTryAgainLater   = 1013
+)
+
+const (
+	// maxWebSocketMessage caps one message from a client, after reassembly.
+	maxWebSocketMessage = 1 << 20
+	// wsPingInterval is how often the server pings, and wsReadTimeout how
+	// long it waits for any frame, pongs included, before giving up on the
+	// client.
+	wsPingInterval = 30 * time.Second
+	wsReadTimeout  = 2 * wsPingInterval
+)
+
+// closeError is returned by readMessage once the connection is closing, and
+// carries the close code to answer with.
+type closeError struct {
+	code   int
+	reason string
+}
+
+func (e *closeError) Error() string {
+	return fmt.Sprintf("websocket closed (%d): %s", e.code, e.reason)
+}
+
+// wsConn is a server-side WebSocket connection. Reads happen on one
+// goroutine; writes may come from any and are serialised.
+type wsConn struct {
+	conn        net.Conn
+	r           *bufio.Reader
+	readTimeout time.Duration
+
+	writeMu      sync.Mutex
+	writeTimeout time.Duration
+	closeOnce    sync.Once
+}
+
+// upgradeWebSocket performs the opening handshake and takes over the
+// connection. On failure it has already answered the request.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		writeError(w, http.StatusBadRequest, "Expected a WebSocket upgrade")
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		writeError(w, http.StatusUpgradeRequired, "Unsupported WebSocket version")
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		writeError(w, http.StatusBadRequest, "Invalid Sec-WebSocket-Key")
+		return nil, errors.New("invalid websocket key")
+	}
+
+	conn, brw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "WebSocket not supported")
+		return nil, err
+	}
+	// The handshake deadline is lifted once the connection is up.
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	fmt.Fprintf(brw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return &wsConn{conn: conn, r: brw.Reader, readTimeout: wsReadTimeout, writeTimeout: streamWriteTimeout}, nil
+}
+
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHasToken reports whether a comma-separated header contains token,
+// ignoring case.
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// readMessage returns the next text message, answering pings and pongs on
+// the way. It returns a *closeError when the client closes the connection
+// or breaks the protocol; the caller should then close with that code.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var (
+		msg       []byte
+		inMessage bool
+		isBinary  bool
+	)
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			return nil, err
+		}
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return nil, parseClose(payload)
+		case opText, opBinary:
+			if inMessage {
+				return nil, &closeError{code: closeProtocolError, reason: "expected a continuation frame"}
+			}
+			inMessage, isBinary = true, op == opBinary
+		case opContinuation:
+			if !inMessage {
+				return nil, &closeError{code: closeProtocolError, reason: "unexpected continuation frame"}
+			}
+		default:
+			return nil, &closeError{code: closeProtocolError, reason: fmt.Sprintf("unknown opcode %d", op)}
+		}
+
+		if len(msg)+len(payload) > maxWebSocketMessage {
+			return nil, &closeError{code: closeTooBig, reason: "message too big"}
+		}
+		msg = append(msg, payload...)
+		if !fin {
+			continue
+		}
+		if isBinary {
+			return nil, &closeError{code: closeUnsupportedData, reason: "only text messages are accepted"}
+		}
+		if !utf8.Valid(msg) {
+			return nil, &closeError{code: closeInvalidPayload, reason: "message is not valid UTF-8"}
+		}
+		return msg, nil
+	}
+}
+
+// parseClose returns the closeError answering a client's close frame: its own
+// code, or 1000 if it sent none, or 1002 if the payload is not a valid code
+// followed by a UTF-8 reason.
+func parseClose(payload []byte) *closeError {
+	switch {
+	case len(payload) == 0:
+		return &closeError{code: closeNormal}
+	case len(payload) == 1:
+		return &closeError{code: closeProtocolError, reason: "close payload too short"}
+	}
+	code := int(binary.BigEndian.Uint16(payload))
+	if !validCloseCode(code) {
+		return &closeError{code: closeProtocolError, reason: fmt.Sprintf("invalid close code %d", code)}
+	}
+	if !utf8.Valid(payload[2:]) {
+		return &closeError{code: closeProtocolError, reason: "close reason is not valid UTF-8"}
+	}
+	return &closeError{code: code, reason: string(payload[2:])}
+}
+
+// validCloseCode reports whether a peer may send code in a close frame: one
+// of the codes defined for that (RFC 6455 section 7.4 and the IANA registry),
+// or one in the ranges left to libraries and applications. 1005, 1006 and
+// 1015 only stand for a missing code and are never sent.
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 1000 && code <= 1003, code >= 1007 && code <= 1014:
+		return true
+	default:
+		return code >= 3000 && code <= 4999
+	}
+}
+
+// readFrame reads and unmasks one frame.
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	if c.readTimeout > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	op = head[0] & 0x0f
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, &closeError{code: closeProtocolError, reason: "reserved bits set"}
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, &closeError{code: closeProtocolError, reason: "client frames must be masked"}
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= opClose && (length > 125 || !fin) {
+		return false, 0, nil, &closeError{code: closeProtocolError, reason: "invalid control frame"}
+	}
+	if length > maxWebSocketMessage {
+		return false, 0, nil, &closeError{code: closeTooBig, reason: "message too big"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// writeText sends one text message.
+func (c *wsConn) writeText(data []byte) error {
+	return c.writeFrame(opText, data)
+}
+
+// writeFrame sends one unfragmented, unmasked frame.
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	head := []byte{0x80 | op}
+	switch n := len(payload); {
+	case n <= 125:
+		head = append(head, byte(n))
+	case n <= 0xffff:
+		head = append(head, 126, byte(n>>8), byte(n))
+	default:
+		head = append(head, 127)
+		head = binary.BigEndian.AppendUint64(head, uint64(n))
+	}
+
+	c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout))
+	if _, err := c.conn.Write(append(head, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// close sends a close frame with code and reason, then closes the
+// connection. Only the first call has any effect.
+func (c *wsConn) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+		if len(reason) > 123 {
+			reason = reason[:123]
+		}
+		c.writeFrame(opClose, append(payload, reason...))
+		c.conn.Close()
+	})
+}
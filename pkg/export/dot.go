@@ -0,0 +1,61 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// WriteDOT writes the graph in the Graphviz DOT language. Concepts are
+// labelled and carry kind, user and introduced attributes; edges are
+// labelled with their relation and carry it as relation too. An edge's
+// weight is written as edge_weight, since Graphviz's own weight attribute
+// steers the layout and must be a whole number for dot.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph %s {\n", dotID("enkente"))
+	if desc := g.description(); desc != "" {
+		fmt.Fprintf(bw, "  comment=%s;\n", dotID(desc))
+	}
+	for _, c := range g.Concepts {
+		attrs := dotAttrs(
+			"label", c.Label,
+			"kind", c.Kind,
+			"user", c.Provenance.User,
+			"introduced", gexfTime(g.Introduced[c.ID]),
+		)
+		fmt.Fprintf(bw, "  %s [%s];\n", dotID(c.ID), attrs)
+	}
+	for _, e := range g.Edges {
+		attrs := dotAttrs(
+			"id", e.ID,
+			"label", e.Relation,
+			"relation", e.Relation,
+			"edge_weight", strconv.FormatFloat(e.Weight, 'g', -1, 64),
+		)
+		fmt.Fprintf(bw, "  %s -> %s [%s];\n", dotID(e.From), dotID(e.To), attrs)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// dotAttrs renders key/value pairs as a DOT attribute list, dropping empty
+// values.
+func dotAttrs(kv ...string) string {
+	var parts []string
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			parts = append(parts, kv[i]+"="+dotID(kv[i+1]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+
+// dotID quotes s as a DOT identifier.
+func dotID(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
@@ -0,0 +1,233 @@
+// Package export shapes the stored concept graph for visualization: as
+// node-link JSON for force-directed layouts, as a tree rooted at one
+// concept, and as a timeline of when concepts were introduced.
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// Formats an export can be shaped into.
+const (
+	FormatNodeLink = "node-link"
+	FormatTree     = "tree"
+	FormatTimeline = "timeline"
+)
+
+// File formats of graph tools an export can be written in.
+const (
+	FormatGraphML = "graphml"
+	FormatGEXF    = "gexf"
+	FormatDOT     = "dot"
+)
+
+// Formats lists every format Shape accepts.
+var Formats = []string{FormatNodeLink, FormatTree, FormatTimeline}
+
+// FileFormats lists the formats Write accepts besides Formats.
+var FileFormats = []string{FormatGraphML, FormatGEXF, FormatDOT}
+
+// ErrUnknownFormat is returned for a format in neither Formats nor
+// FileFormats.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// ErrNoRoot is returned when a tree is asked for without a root concept.
+var ErrNoRoot = errors.New("a tree needs a root concept")
+
+// DefaultInterval is the width of a timeline bucket when none is given.
+const DefaultInterval = time.Hour
+
+// Graph is the part of the concept graph an export covers.
+type Graph struct {
+	// Namespace and SessionID record the scope the graph was loaded with.
+	Namespace storage.Namespace
+	SessionID string
+
+	// Concepts and Edges are ordered by id. Every edge's endpoints are in
+	// Concepts.
+	Concepts []storage.Concept
+	Edges    []storage.Edge
+
+	// Introduced is when each concept was first mentioned: the timestamp
+	// of its FirstSeen message if that is stored, or else when the concept
+	// was created.
+	Introduced map[string]time.Time
+	// Evidenced holds, for each edge, the timestamps of the stored
+	// messages among its evidence, oldest first.
+	Evidenced map[string][]time.Time
+}
+
+// Load reads the graph in store's namespace. With a session id it keeps
+// only what that session touched: the concepts first seen in it, the edges
+// with evidence from it, and the concepts those edges join.
+func Load(store *storage.BoltStorage, sessionID string) (*Graph, error) {
+	concepts, err := store.ListConcepts()
+	if err != nil {
+		return nil, fmt.Errorf("list concepts: %w", err)
+	}
+	edges, err := store.ListEdges()
+	if err != nil {
+		return nil, fmt.Errorf("list edges: %w", err)
+	}
+
+	g := &Graph{
+		Namespace:  store.CurrentNamespace(),
+		SessionID:  sessionID,
+		Introduced: map[string]time.Time{},
+		Evidenced:  map[string][]time.Time{},
+	}
+	keep := map[string]bool{}
+	for _, c := range concepts {
+		keep[c.ID] = sessionID == "" || (c.FirstSeen != nil && c.FirstSeen.SessionID == sessionID)
+	}
+	for _, e := range edges {
+		// The concepts are read apart from the edges, so an edge may
+		// have lost an endpoint in between.
+		if _, ok := keep[e.From]; !ok {
+			continue
+		}
+		if _, ok := keep[e.To]; !ok {
+			continue
+		}
+		if sessionID != "" && !slices.ContainsFunc(e.Evidence, func(ref storage.MessageRef) bool {
+			return ref.SessionID == sessionID
+		}) {
+			continue
+		}
+		keep[e.From], keep[e.To] = true, true
+		g.Edges = append(g.Edges, e)
+	}
+
+	// Messages are looked up once each, since many concepts and edges
+	// can cite one.
+	times := map[storage.MessageRef]time.Time{}
+	messageTime := func(ref storage.MessageRef) (time.Time, error) {
+		if at, ok := times[ref]; ok {
+			return at, nil
+		}
+		msg, err := store.GetMessage(ref.SessionID, ref.MessageID)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("read message %s/%d: %w", ref.SessionID, ref.MessageID, err)
+		}
+		var at time.Time
+		if msg != nil {
+			at = msg.Timestamp
+		}
+		times[ref] = at
+		return at, nil
+	}
+
+	for _, c := range concepts {
+		if !keep[c.ID] {
+			continue
+		}
+		g.Concepts = append(g.Concepts, c)
+		g.Introduced[c.ID] = c.CreatedAt
+		if c.FirstSeen == nil {
+			continue
+		}
+		at, err := messageTime(*c.FirstSeen)
+		if err != nil {
+			return nil, err
+		}
+		if !at.IsZero() {
+			g.Introduced[c.ID] = at
+		}
+	}
+	for _, e := range g.Edges {
+		for _, ref := range e.Evidence {
+			at, err := messageTime(ref)
+			if err != nil {
+				return nil, err
+			}
+			if !at.IsZero() {
+				g.Evidenced[e.ID] = append(g.Evidenced[e.ID], at)
+			}
+		}
+		slices.SortFunc(g.Evidenced[e.ID], time.Time.Compare)
+	}
+	return g, nil
+}
+
+// Options tune the shapes that need more than the graph.
+type Options struct {
+	// Root is the concept a tree starts from.
+	Root string
+	// Direction is which edges a tree follows away from its root.
+	Direction storage.Direction
+	// Depth limits how many levels below the root a tree goes; zero
+	// means no limit.
+	Depth int
+	// Interval is the width of a timeline bucket; zero means
+	// DefaultInterval.
+	Interval time.Duration
+}
+
+// Shape returns the graph in the given format, ready to be encoded as JSON.
+func (g *Graph) Shape(format string, opts Options) (any, error) {
+	switch format {
+	case FormatNodeLink:
+		return g.NodeLink(), nil
+	case FormatTree:
+		return g.Tree(opts.Root, opts.Direction, opts.Depth)
+	case FormatTimeline:
+		return g.Timeline(opts.Interval), nil
+	default:
+		return nil, fmt.Errorf("%w %q (want one of %s)", ErrUnknownFormat, format, strings.Join(Formats, ", "))
+	}
+}
+
+// Write writes the graph to w in the given format: one of Formats, as
+// indented JSON, or one of FileFormats.
+func (g *Graph) Write(w io.Writer, format string, opts Options) error {
+	switch format {
+	case FormatGraphML:
+		return g.WriteGraphML(w)
+	case FormatGEXF:
+		return g.WriteGEXF(w)
+	case FormatDOT:
+		return g.WriteDOT(w)
+	}
+	shaped, err := g.Shape(format, opts)
+	if errors.Is(err, ErrUnknownFormat) {
+		return fmt.Errorf("%w %q (want one of %s)", ErrUnknownFormat, format, strings.Join(slices.Concat(Formats, FileFormats), ", "))
+	}
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(shaped)
+}
+
+// ParseDirection reads a tree direction: "out", "in" or "both".
+func ParseDirection(s string) (storage.Direction, error) {
+	switch s {
+	case "", "out":
+		return storage.Outgoing, nil
+	case "in":
+		return storage.Incoming, nil
+	case "both":
+		return storage.Both, nil
+	default:
+		return 0, fmt.Errorf("invalid direction %q (want out, in or both)", s)
+	}
+}
+
+func (g *Graph) concept(id string) *storage.Concept {
+	i, ok := slices.BinarySearchFunc(g.Concepts, id, func(c storage.Concept, id string) int {
+		return strings.Compare(c.ID, id)
+	})
+	if !ok {
+		return nil
+	}
+	return &g.Concepts[i]
+}
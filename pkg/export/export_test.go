@@ -0,0 +1,161 @@
+package export_test
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/export"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Graph Export", func() {
+	var (
+		dbStore *storage.BoltStorage
+		start   time.Time
+	)
+
+	// Session s1 introduces a, b and c; s2 introduces d and links it to c.
+	//
+	//	a -is_a-> b -is_a-> c <-uses- d
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "export.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+
+		start = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+		msgs := []parser.AntigravityMessage{
+			{SessionID: "s1", MessageID: 0, Type: "user", Timestamp: start.Add(10 * time.Minute)},
+			{SessionID: "s1", MessageID: 1, Type: "user", Timestamp: start.Add(20 * time.Minute)},
+			{SessionID: "s2", MessageID: 0, Type: "user", Timestamp: start.Add(90 * time.Minute)},
+		}
+		Expect(dbStore.SaveMessages(msgs)).To(Succeed())
+
+		for _, c := range []storage.Concept{
+			{ID: "a", Label: "Alpha", Kind: "idea", Provenance: storage.Provenance{User: "ann"}, FirstSeen: &storage.MessageRef{SessionID: "s1", MessageID: 0}},
+			{ID: "b", Label: "Beta", FirstSeen: &storage.MessageRef{SessionID: "s1", MessageID: 0}},
+			{ID: "c", Label: "Gamma", FirstSeen: &storage.MessageRef{SessionID: "s1", MessageID: 1}},
+			{ID: "d", Label: "Delta", FirstSeen: &storage.MessageRef{SessionID: "s2", MessageID: 0}},
+		} {
+			Expect(dbStore.CreateConcept(&c)).To(Succeed())
+		}
+		for _, e := range []storage.Edge{
+			{ID: "ab", From: "a", To: "b", Relation: "is_a", Weight: 0.5, Evidence: []storage.MessageRef{{SessionID: "s1", MessageID: 0}}},
+			{ID: "bc", From: "b", To: "c", Relation: "is_a", Evidence: []storage.MessageRef{{SessionID: "s1", MessageID: 1}}},
+			{ID: "dc", From: "d", To: "c", Relation: "uses", Evidence: []storage.MessageRef{{SessionID: "s2", MessageID: 0}}},
+		} {
+			Expect(dbStore.CreateEdge(&e)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	load := func(session string) *export.Graph {
+		g, err := export.Load(dbStore, session)
+		Expect(err).NotTo(HaveOccurred())
+		return g
+	}
+
+	It("exports node-link JSON", func() {
+		nl := load("").NodeLink()
+		Expect(nl.Directed).To(BeTrue())
+		Expect(nl.Nodes).To(HaveLen(4))
+		a := nl.Nodes[0]
+		Expect([]string{a.ID, a.Label, a.Kind, a.User}).To(Equal([]string{"a", "Alpha", "idea", "ann"}))
+		Expect(a.Introduced).To(BeTemporally("==", start.Add(10*time.Minute)))
+		Expect(nl.Links).To(HaveLen(3))
+		Expect(nl.Links[0]).To(Equal(export.NodeLinkLink{
+			ID: "ab", Source: "a", Target: "b", Relation: "is_a", Weight: 0.5, Evidence: 1,
+		}))
+
+		data, err := json.Marshal(nl)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(data)).To(ContainSubstring(`"source":"a","target":"b"`))
+	})
+
+	It("scopes the graph to a session", func() {
+		g := load("s2")
+		var ids []string
+		for _, c := range g.Concepts {
+			ids = append(ids, c.ID)
+		}
+		// c was introduced in s1 but is joined to d by an s2 edge.
+		Expect(ids).To(Equal([]string{"c", "d"}))
+		Expect(g.Edges).To(HaveLen(1))
+		Expect(g.Edges[0].ID).To(Equal("dc"))
+		Expect(g.NodeLink().Graph.SessionID).To(Equal("s2"))
+	})
+
+	It("scopes the graph to a namespace", func() {
+		scoped, err := dbStore.Namespace("team/retro")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(scoped.CreateConcept(&storage.Concept{ID: "z", Label: "Zeta"})).To(Succeed())
+
+		g, err := export.Load(scoped, "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(g.Concepts).To(HaveLen(1))
+		Expect(g.NodeLink().Graph.Namespace).To(Equal("team/retro"))
+	})
+
+	It("builds a tree rooted at a concept", func() {
+		tree, err := load("").Tree("a", storage.Outgoing, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tree.ID).To(Equal("a"))
+		Expect(tree.Children).To(HaveLen(1))
+		b := tree.Children[0]
+		Expect(b.ID).To(Equal("b"))
+		Expect(b.Relation).To(Equal("is_a"))
+		Expect(b.Children).To(HaveLen(1))
+		Expect(b.Children[0].ID).To(Equal("c"))
+		Expect(b.Children[0].Children).To(BeEmpty())
+
+		tree, err = load("").Tree("c", storage.Incoming, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(tree.Children).To(HaveLen(2))
+		Expect(tree.Children[0].ID).To(Equal("b"))
+		Expect(tree.Children[0].Children).To(BeEmpty())
+		Expect(tree.Children[1].ID).To(Equal("d"))
+	})
+
+	It("rejects a tree without a known root", func() {
+		_, err := load("").Tree("", storage.Outgoing, 0)
+		Expect(err).To(MatchError(export.ErrNoRoot))
+		_, err = load("").Tree("nope", storage.Outgoing, 0)
+		Expect(errors.Is(err, storage.ErrNotFound)).To(BeTrue())
+	})
+
+	It("buckets concept introductions on a timeline", func() {
+		tl := load("").Timeline(time.Hour)
+		Expect(tl.Interval).To(Equal("1h0m0s"))
+		Expect(tl.Buckets).To(HaveLen(2))
+
+		first := tl.Buckets[0]
+		Expect(first.Start).To(BeTemporally("==", start))
+		Expect(first.End).To(BeTemporally("==", start.Add(time.Hour)))
+		var ids []string
+		for _, c := range first.Concepts {
+			ids = append(ids, c.ID)
+		}
+		Expect(ids).To(Equal([]string{"a", "b", "c"}))
+
+		Expect(tl.Buckets[1].Start).To(BeTemporally("==", start.Add(time.Hour)))
+		Expect(tl.Buckets[1].Concepts[0].ID).To(Equal("d"))
+	})
+
+	It("shapes the graph by format name", func() {
+		g := load("")
+		for _, format := range export.Formats {
+			_, err := g.Shape(format, export.Options{Root: "a"})
+			Expect(err).NotTo(HaveOccurred(), format)
+		}
+		_, err := g.Shape("pie-chart", export.Options{})
+		Expect(errors.Is(err, export.ErrUnknownFormat)).To(BeTrue())
+	})
+})
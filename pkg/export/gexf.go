@@ -0,0 +1,174 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+)
+
+// GEXF 1.3, as read by Gephi.
+
+type gexfDoc struct {
+	XMLName xml.Name  `xml:"gexf"`
+	XMLNS   string    `xml:"xmlns,attr"`
+	Version string    `xml:"version,attr"`
+	Meta    gexfMeta  `xml:"meta"`
+	Graph   gexfGraph `xml:"graph"`
+}
+
+type gexfMeta struct {
+	LastModified string `xml:"lastmodifieddate,attr"`
+	Creator      string `xml:"creator"`
+	Description  string `xml:"description,omitempty"`
+}
+
+type gexfGraph struct {
+	Mode            string           `xml:"mode,attr"`
+	DefaultEdgeType string           `xml:"defaultedgetype,attr"`
+	TimeFormat      string           `xml:"timeformat,attr"`
+	Attributes      []gexfAttributes `xml:"attributes"`
+	Nodes           []gexfNode       `xml:"nodes>node"`
+	Edges           []gexfEdge       `xml:"edges>edge"`
+}
+
+type gexfAttributes struct {
+	Class      string          `xml:"class,attr"`
+	Mode       string          `xml:"mode,attr"`
+	Attributes []gexfAttribute `xml:"attribute"`
+}
+
+type gexfAttribute struct {
+	ID    string `xml:"id,attr"`
+	Title string `xml:"title,attr"`
+	Type  string `xml:"type,attr"`
+}
+
+type gexfNode struct {
+	ID        string         `xml:"id,attr"`
+	Label     string         `xml:"label,attr"`
+	Start     string         `xml:"start,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue,omitempty"`
+}
+
+type gexfEdge struct {
+	ID        string         `xml:"id,attr"`
+	Source    string         `xml:"source,attr"`
+	Target    string         `xml:"target,attr"`
+	Label     string         `xml:"label,attr,omitempty"`
+	Weight    float64        `xml:"weight,attr"`
+	Start     string         `xml:"start,attr,omitempty"`
+	AttValues []gexfAttValue `xml:"attvalues>attvalue,omitempty"`
+}
+
+type gexfAttValue struct {
+	For   string `xml:"for,attr"`
+	Value string `xml:"value,attr"`
+	Start string `xml:"start,attr,omitempty"`
+	End   string `xml:"end,attr,omitempty"`
+}
+
+// WriteGEXF writes the graph as a dynamic GEXF graph, so that Gephi's
+// timeline can replay the brainstorm. Each concept appears when it was
+// introduced, and each edge when the first message evidencing it was sent
+// or once both its concepts have appeared, whichever is later. An edge's
+// evidence attribute counts its messages over time, stepping up at each
+// one's timestamp. Concepts also carry their kind and provenance user, and
+// edges their relation, as label too, and their weight.
+func (g *Graph) WriteGEXF(w io.Writer) error {
+	doc := gexfDoc{
+		XMLNS:   "http://gexf.net/1.3",
+		Version: "1.3",
+		Meta: gexfMeta{
+			LastModified: time.Now().UTC().Format(time.DateOnly),
+			Creator:      "enkente",
+			Description:  g.description(),
+		},
+		Graph: gexfGraph{
+			Mode:            "dynamic",
+			DefaultEdgeType: "directed",
+			TimeFormat:      "dateTime",
+			Attributes: []gexfAttributes{
+				{Class: "node", Mode: "static", Attributes: []gexfAttribute{
+					{ID: "kind", Title: "kind", Type: "string"},
+					{ID: "user", Title: "user", Type: "string"},
+				}},
+				{Class: "edge", Mode: "static", Attributes: []gexfAttribute{
+					{ID: "relation", Title: "relation", Type: "string"},
+				}},
+				{Class: "edge", Mode: "dynamic", Attributes: []gexfAttribute{
+					{ID: "evidence", Title: "evidence", Type: "integer"},
+				}},
+			},
+		},
+	}
+
+	for _, c := range g.Concepts {
+		n := gexfNode{ID: c.ID, Label: c.Label, Start: gexfTime(g.Introduced[c.ID])}
+		for _, v := range []gexfAttValue{{For: "kind", Value: c.Kind}, {For: "user", Value: c.Provenance.User}} {
+			if v.Value != "" {
+				n.AttValues = append(n.AttValues, v)
+			}
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, n)
+	}
+
+	for _, e := range g.Edges {
+		edge := gexfEdge{
+			ID:        e.ID,
+			Source:    e.From,
+			Target:    e.To,
+			Label:     e.Relation,
+			Weight:    e.Weight,
+			AttValues: []gexfAttValue{{For: "relation", Value: e.Relation}},
+		}
+		// An edge cannot predate its endpoints.
+		start := laterOf(g.Introduced[e.From], g.Introduced[e.To])
+		times := g.Evidenced[e.ID]
+		if len(times) > 0 {
+			start = laterOf(start, times[0])
+		}
+		edge.Start = gexfTime(start)
+		// One spell per distinct timestamp, each ending where the next
+		// begins, so that spells do not overlap.
+		for i, at := range times {
+			if i+1 < len(times) && times[i+1].Equal(at) {
+				continue
+			}
+			v := gexfAttValue{For: "evidence", Value: strconv.Itoa(i + 1), Start: gexfTime(at)}
+			if i+1 < len(times) {
+				v.End = gexfTime(times[i+1])
+			}
+			edge.AttValues = append(edge.AttValues, v)
+		}
+		doc.Graph.Edges = append(doc.Graph.Edges, edge)
+	}
+	return writeXML(w, doc)
+}
+
+func (g *Graph) description() string {
+	switch {
+	case g.Namespace != "" && g.SessionID != "":
+		return "namespace " + string(g.Namespace) + ", session " + g.SessionID
+	case g.Namespace != "":
+		return "namespace " + string(g.Namespace)
+	case g.SessionID != "":
+		return "session " + g.SessionID
+	}
+	return ""
+}
+
+// gexfTime formats t for a dateTime graph, or returns "" for the zero time.
+func gexfTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func laterOf(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,137 @@
+package export
+
+import (
+	"encoding/xml"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GraphML, as read by yEd, Gephi and networkx.
+
+type graphmlDoc struct {
+	XMLName        xml.Name     `xml:"graphml"`
+	XMLNS          string       `xml:"xmlns,attr"`
+	XSI            string       `xml:"xmlns:xsi,attr"`
+	SchemaLocation string       `xml:"xsi:schemaLocation,attr"`
+	Keys           []graphmlKey `xml:"key"`
+	Graph          graphmlGraph `xml:"graph"`
+}
+
+type graphmlKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphmlGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphmlData `xml:"data"`
+	Nodes       []graphmlNode `xml:"node"`
+	Edges       []graphmlEdge `xml:"edge"`
+}
+
+type graphmlNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphmlData `xml:"data"`
+}
+
+type graphmlEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphmlData `xml:"data"`
+}
+
+type graphmlData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+var graphmlKeys = []graphmlKey{
+	{ID: "namespace", For: "graph", AttrName: "namespace", AttrType: "string"},
+	{ID: "session", For: "graph", AttrName: "session", AttrType: "string"},
+	{ID: "label", For: "node", AttrName: "label", AttrType: "string"},
+	{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+	{ID: "user", For: "node", AttrName: "user", AttrType: "string"},
+	{ID: "aliases", For: "node", AttrName: "aliases", AttrType: "string"},
+	{ID: "introduced", For: "node", AttrName: "introduced", AttrType: "string"},
+	{ID: "relation", For: "edge", AttrName: "relation", AttrType: "string"},
+	{ID: "weight", For: "edge", AttrName: "weight", AttrType: "double"},
+	{ID: "evidence", For: "edge", AttrName: "evidence", AttrType: "int"},
+}
+
+// WriteGraphML writes the graph as GraphML. Concepts carry their label,
+// kind, provenance user, aliases and introduction time; edges their
+// relation, weight and how many messages evidence them. Empty values are
+// left out.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphmlDoc{
+		XMLNS:          "http://graphml.graphdrawing.org/xmlns",
+		XSI:            "http://www.w3.org/2001/XMLSchema-instance",
+		SchemaLocation: "http://graphml.graphdrawing.org/xmlns http://graphml.graphdrawing.org/xmlns/1.0/graphml.xsd",
+		Keys:           graphmlKeys,
+		Graph: graphmlGraph{
+			ID:          "enkente",
+			EdgeDefault: "directed",
+			Data:        graphmlValues("namespace", string(g.Namespace), "session", g.SessionID),
+		},
+	}
+	for _, c := range g.Concepts {
+		introduced := ""
+		if at := g.Introduced[c.ID]; !at.IsZero() {
+			introduced = at.UTC().Format(time.RFC3339)
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphmlNode{
+			ID: c.ID,
+			Data: graphmlValues(
+				"label", c.Label,
+				"kind", c.Kind,
+				"user", c.Provenance.User,
+				"aliases", strings.Join(c.Aliases, ", "),
+				"introduced", introduced,
+			),
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphmlEdge{
+			ID:     e.ID,
+			Source: e.From,
+			Target: e.To,
+			Data: graphmlValues(
+				"relation", e.Relation,
+				"weight", strconv.FormatFloat(e.Weight, 'g', -1, 64),
+				"evidence", strconv.Itoa(len(e.Evidence)),
+			),
+		})
+	}
+	return writeXML(w, doc)
+}
+
+// graphmlValues pairs keys with values, dropping empty values.
+func graphmlValues(kv ...string) []graphmlData {
+	var out []graphmlData
+	for i := 0; i+1 < len(kv); i += 2 {
+		if kv[i+1] != "" {
+			out = append(out, graphmlData{Key: kv[i], Value: kv[i+1]})
+		}
+	}
+	return out
+}
+
+// writeXML writes v as an indented XML document.
+func writeXML(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
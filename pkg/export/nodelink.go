@@ -0,0 +1,83 @@
+package export
+
+import (
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// NodeLink is the node-link form read by d3-force and networkx: nodes, and
+// links naming the ids of their source and target nodes.
+type NodeLink struct {
+	Directed   bool           `json:"directed"`
+	Multigraph bool           `json:"multigraph"`
+	Graph      GraphInfo      `json:"graph"`
+	Nodes      []NodeLinkNode `json:"nodes"`
+	Links      []NodeLinkLink `json:"links"`
+}
+
+// GraphInfo describes the scope of an exported graph.
+type GraphInfo struct {
+	Namespace string `json:"namespace,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+}
+
+// NodeLinkNode is a concept.
+type NodeLinkNode struct {
+	ID      string   `json:"id"`
+	Label   string   `json:"label"`
+	Kind    string   `json:"kind,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+	// User is who introduced the concept, from its provenance.
+	User       string              `json:"user,omitempty"`
+	FirstSeen  *storage.MessageRef `json:"firstSeen,omitempty"`
+	Introduced time.Time           `json:"introduced"`
+}
+
+// NodeLinkLink is an edge.
+type NodeLinkLink struct {
+	ID       string  `json:"id"`
+	Source   string  `json:"source"`
+	Target   string  `json:"target"`
+	Relation string  `json:"relation"`
+	Weight   float64 `json:"weight"`
+	// Evidence counts the messages the edge was drawn from.
+	Evidence int `json:"evidence"`
+}
+
+// NodeLink returns the graph in node-link form.
+func (g *Graph) NodeLink() *NodeLink {
+	out := &NodeLink{
+		Directed:   true,
+		Multigraph: true,
+		Graph:      g.info(),
+		Nodes:      make([]NodeLinkNode, len(g.Concepts)),
+		Links:      make([]NodeLinkLink, len(g.Edges)),
+	}
+	for i, c := range g.Concepts {
+		out.Nodes[i] = NodeLinkNode{
+			ID:         c.ID,
+			Label:      c.Label,
+			Kind:       c.Kind,
+			Aliases:    c.Aliases,
+			User:       c.Provenance.User,
+			FirstSeen:  c.FirstSeen,
+			Introduced: g.Introduced[c.ID],
+		}
+	}
+	for i, e := range g.Edges {
+		out.Links[i] = NodeLinkLink{
+			ID:       e.ID,
+			Source:   e.From,
+			Target:   e.To,
+			Relation: e.Relation,
+			Weight:   e.Weight,
+			Evidence: len(e.Evidence),
+		}
+	}
+	return out
+}
+
+func (g *Graph) info() GraphInfo {
+	return GraphInfo{Namespace: string(g.Namespace), SessionID: g.SessionID}
+}
@@ -0,0 +1,67 @@
+package export
+
+import (
+	"cmp"
+	"slices"
+	"time"
+)
+
+// Timeline groups concepts by when they were introduced.
+type Timeline struct {
+	Graph GraphInfo `json:"graph"`
+	// Interval is the width of each bucket, as a Go duration string.
+	Interval string `json:"interval"`
+	// Buckets are in time order. Intervals in which no concept was
+	// introduced are left out.
+	Buckets []TimelineBucket `json:"buckets"`
+}
+
+// TimelineBucket is the concepts introduced in [Start, End).
+type TimelineBucket struct {
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Concepts []TimelineConcept `json:"concepts"`
+}
+
+// TimelineConcept is a concept and when it was introduced.
+type TimelineConcept struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label"`
+	Kind       string    `json:"kind,omitempty"`
+	User       string    `json:"user,omitempty"`
+	Introduced time.Time `json:"introduced"`
+}
+
+// Timeline returns the concepts bucketed by when they were introduced, in
+// buckets of the given width with boundaries as time.Time.Truncate puts
+// them, so hours and days start on the hour and at midnight UTC. Within a
+// bucket concepts are ordered by time, then id.
+func (g *Graph) Timeline(interval time.Duration) *Timeline {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	entries := make([]TimelineConcept, len(g.Concepts))
+	for i, c := range g.Concepts {
+		entries[i] = TimelineConcept{
+			ID:         c.ID,
+			Label:      c.Label,
+			Kind:       c.Kind,
+			User:       c.Provenance.User,
+			Introduced: g.Introduced[c.ID].UTC(),
+		}
+	}
+	slices.SortStableFunc(entries, func(a, b TimelineConcept) int {
+		return cmp.Or(a.Introduced.Compare(b.Introduced), cmp.Compare(a.ID, b.ID))
+	})
+
+	out := &Timeline{Graph: g.info(), Interval: interval.String(), Buckets: []TimelineBucket{}}
+	for _, e := range entries {
+		start := e.Introduced.Truncate(interval)
+		if n := len(out.Buckets); n == 0 || !out.Buckets[n-1].Start.Equal(start) {
+			out.Buckets = append(out.Buckets, TimelineBucket{Start: start, End: start.Add(interval)})
+		}
+		last := &out.Buckets[len(out.Buckets)-1]
+		last.Concepts = append(last.Concepts, e)
+	}
+	return out
+}
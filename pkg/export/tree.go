@@ -0,0 +1,74 @@
+package export
+
+import (
+	"fmt"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+// TreeNode is a concept in a tree, in the nested form read by
+// d3.hierarchy.
+type TreeNode struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+	Kind  string `json:"kind,omitempty"`
+	// EdgeID and Relation name the edge that leads to this node from its
+	// parent; they are empty at the root.
+	EdgeID   string      `json:"edgeId,omitempty"`
+	Relation string      `json:"relation,omitempty"`
+	Children []*TreeNode `json:"children,omitempty"`
+}
+
+// Tree returns a spanning tree of the concepts reachable from root by
+// following edges in dir, breadth first, so each concept hangs off the
+// parent nearest the root. Edges are taken in id order, and a concept
+// reached twice keeps its first place. depth limits the levels below the
+// root; zero means no limit.
+func (g *Graph) Tree(root string, dir storage.Direction, depth int) (*TreeNode, error) {
+	if root == "" {
+		return nil, ErrNoRoot
+	}
+	c := g.concept(root)
+	if c == nil {
+		return nil, fmt.Errorf("concept %s: %w", root, storage.ErrNotFound)
+	}
+
+	adjacent := map[string][]storage.Edge{}
+	for _, e := range g.Edges {
+		if dir == storage.Outgoing || dir == storage.Both {
+			adjacent[e.From] = append(adjacent[e.From], e)
+		}
+		if (dir == storage.Incoming || dir == storage.Both) && e.From != e.To {
+			adjacent[e.To] = append(adjacent[e.To], e)
+		}
+	}
+
+	top := treeNode(c)
+	placed := map[string]bool{root: true}
+	level := []*TreeNode{top}
+	for d := 0; len(level) > 0 && (depth <= 0 || d < depth); d++ {
+		var next []*TreeNode
+		for _, parent := range level {
+			for _, e := range adjacent[parent.ID] {
+				other := e.To
+				if other == parent.ID {
+					other = e.From
+				}
+				if placed[other] {
+					continue
+				}
+				placed[other] = true
+				child := treeNode(g.concept(other))
+				child.EdgeID, child.Relation = e.ID, e.Relation
+				parent.Children = append(parent.Children, child)
+				next = append(next, child)
+			}
+		}
+		level = next
+	}
+	return top, nil
+}
+
+func treeNode(c *storage.Concept) *TreeNode {
+	return &TreeNode{ID: c.ID, Label: c.Label, Kind: c.Kind}
+}
@@ -0,0 +1,160 @@
+package export_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/export"
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Graph File Formats", func() {
+	var (
+		g     *export.Graph
+		start time.Time
+	)
+
+	// a -"says \"hi\""-> b, evidenced by two messages a minute apart.
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "writers.db"))
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(store.Close)
+
+		start = time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+		Expect(store.SaveMessages([]parser.AntigravityMessage{
+			{SessionID: "s", MessageID: 0, Type: "user", Timestamp: start},
+			{SessionID: "s", MessageID: 1, Type: "user", Timestamp: start.Add(time.Minute)},
+		})).To(Succeed())
+		Expect(store.CreateConcept(&storage.Concept{
+			ID: "a", Label: "Alpha & Omega", Kind: "idea",
+			Provenance: storage.Provenance{User: "ann"},
+			FirstSeen:  &storage.MessageRef{SessionID: "s", MessageID: 0},
+		})).To(Succeed())
+		Expect(store.CreateConcept(&storage.Concept{
+			ID: "b", Label: "Beta",
+			FirstSeen: &storage.MessageRef{SessionID: "s", MessageID: 0},
+		})).To(Succeed())
+		Expect(store.CreateEdge(&storage.Edge{
+			ID: "ab", From: "a", To: "b", Relation: `says "hi"`, Weight: 0.75,
+			Evidence: []storage.MessageRef{{SessionID: "s", MessageID: 0}, {SessionID: "s", MessageID: 1}},
+		})).To(Succeed())
+
+		g, err = export.Load(store, "")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	write := func(format string) string {
+		var buf bytes.Buffer
+		Expect(g.Write(&buf, format, export.Options{})).To(Succeed())
+		return buf.String()
+	}
+
+	It("writes GraphML with concept and edge attributes", func() {
+		out := write(export.FormatGraphML)
+
+		var doc struct {
+			Keys []struct {
+				ID string `xml:"id,attr"`
+			} `xml:"key"`
+			Graph struct {
+				Nodes []struct {
+					ID   string `xml:"id,attr"`
+					Data []struct {
+						Key   string `xml:"key,attr"`
+						Value string `xml:",chardata"`
+					} `xml:"data"`
+				} `xml:"node"`
+				Edges []struct {
+					Source string `xml:"source,attr"`
+					Target string `xml:"target,attr"`
+					Data   []struct {
+						Key   string `xml:"key,attr"`
+						Value string `xml:",chardata"`
+					} `xml:"data"`
+				} `xml:"edge"`
+			} `xml:"graph"`
+		}
+		Expect(xml.Unmarshal([]byte(out), &doc)).To(Succeed(), out)
+		Expect(doc.Graph.Nodes).To(HaveLen(2))
+		Expect(doc.Graph.Nodes[0].Data).To(ContainElements(
+			HaveField("Value", "Alpha & Omega"),
+			HaveField("Value", "idea"),
+			HaveField("Value", "ann"),
+			HaveField("Value", "2026-10-18T09:00:00Z"),
+		))
+		Expect(doc.Graph.Edges).To(HaveLen(1))
+		Expect(doc.Graph.Edges[0].Source).To(Equal("a"))
+		Expect(doc.Graph.Edges[0].Data).To(ContainElements(
+			And(HaveField("Key", "weight"), HaveField("Value", "0.75")),
+			And(HaveField("Key", "evidence"), HaveField("Value", "2")),
+		))
+		Expect(out).To(ContainSubstring(`edgedefault="directed"`))
+	})
+
+	It("writes dynamic GEXF sliced by message timestamps", func() {
+		out := write(export.FormatGEXF)
+
+		var doc struct {
+			Graph struct {
+				Mode  string `xml:"mode,attr"`
+				Nodes []struct {
+					ID    string `xml:"id,attr"`
+					Start string `xml:"start,attr"`
+				} `xml:"nodes>node"`
+				Edges []struct {
+					Weight    string `xml:"weight,attr"`
+					Start     string `xml:"start,attr"`
+					AttValues []struct {
+						For   string `xml:"for,attr"`
+						Value string `xml:"value,attr"`
+						Start string `xml:"start,attr"`
+						End   string `xml:"end,attr"`
+					} `xml:"attvalues>attvalue"`
+				} `xml:"edges>edge"`
+			} `xml:"graph"`
+		}
+		Expect(xml.Unmarshal([]byte(out), &doc)).To(Succeed(), out)
+		Expect(doc.Graph.Mode).To(Equal("dynamic"))
+		Expect(doc.Graph.Nodes[0].Start).To(Equal("2026-10-18T09:00:00Z"))
+
+		edge := doc.Graph.Edges[0]
+		Expect(edge.Weight).To(Equal("0.75"))
+		Expect(edge.Start).To(Equal("2026-10-18T09:00:00Z"))
+		var evidence []string
+		for _, v := range edge.AttValues {
+			if v.For == "evidence" {
+				evidence = append(evidence, v.Value+"@"+v.Start+"-"+v.End)
+			}
+		}
+		Expect(evidence).To(Equal([]string{
+			"1@2026-10-18T09:00:00Z-2026-10-18T09:01:00Z",
+			"2@2026-10-18T09:01:00Z-",
+		}))
+	})
+
+	It("writes Graphviz DOT with escaped identifiers", func() {
+		out := write(export.FormatDOT)
+		Expect(out).To(HavePrefix(`digraph "enkente" {`))
+		Expect(out).To(ContainSubstring(`"a" [label="Alpha & Omega", kind="idea", user="ann", introduced="2026-10-18T09:00:00Z"];`))
+		Expect(out).To(ContainSubstring(`"a" -> "b" [id="ab", label="says \"hi\"", relation="says \"hi\"", edge_weight="0.75"];`))
+		Expect(strings.TrimSpace(out)).To(HaveSuffix("}"))
+	})
+
+	It("writes the JSON shapes too", func() {
+		Expect(write(export.FormatNodeLink)).To(ContainSubstring(`"links": [`))
+	})
+
+	It("rejects unknown formats", func() {
+		err := g.Write(&bytes.Buffer{}, "svg", export.Options{})
+		Expect(errors.Is(err, export.ErrUnknownFormat)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("gexf"))
+	})
+})
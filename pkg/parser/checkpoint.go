@@ -0,0 +1,28 @@
+package parser
+
+import "time"
+
+// Checkpoint records how far a tailer has read a log file.
+type Checkpoint struct {
+	// Path is the absolute path of the log file.
+	Path string `json:"path"`
+	// FileID identifies the file behind Path, so a rotated or recreated log
+	// is read from the start rather than from a stale position.
+	FileID string `json:"fileId,omitempty"`
+	// Offset is the number of bytes consumed from an NDJSON log.
+	Offset int64 `json:"offset"`
+	// Index is the number of elements consumed from a JSON array log.
+	Index int `json:"index"`
+	// LastMessageID is the id of the last message handed to the workers, or
+	// -1 if none has been.
+	LastMessageID int       `json:"lastMessageId"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// CheckpointStore persists tailer checkpoints across restarts.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the checkpoint saved for path, or nil if there is none.
+	LoadCheckpoint(path string) (*Checkpoint, error)
+	// SaveCheckpoint stores cp, replacing any previous checkpoint for cp.Path.
+	SaveCheckpoint(cp Checkpoint) error
+}
@@ -0,0 +1,117 @@
+package parser_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
+)
+
+// memCheckpoints is an in-memory parser.CheckpointStore.
+type memCheckpoints struct {
+	mu  sync.Mutex
+	cps map[string]parser.Checkpoint
+}
+
+func (m *memCheckpoints) LoadCheckpoint(path string) (*parser.Checkpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp, ok := m.cps[path]
+	if !ok {
+		return nil, nil
+	}
+	return &cp, nil
+}
+
+func (m *memCheckpoints) SaveCheckpoint(cp parser.Checkpoint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cps[cp.Path] = cp
+	return nil
+}
+
+var _ = Describe("Tailer Checkpoints", func() {
+	var (
+		tempFile    string
+		checkpoints *memCheckpoints
+	)
+
+	BeforeEach(func() {
+		tempFile = filepath.Join(GinkgoT().TempDir(), "resume.ndjson")
+		checkpoints = &memCheckpoints{cps: map[string]parser.Checkpoint{}}
+		lines := `{"sessionId":"s","messageId":0}` + "\n" + `{"sessionId":"s","messageId":1}` + "\n"
+		Expect(os.WriteFile(tempFile, []byte(lines), 0644)).To(Succeed())
+	})
+
+	// run tails the log until n messages have been handled, then stops and
+	// returns their ids.
+	run := func(n int, replay bool) []int {
+		var (
+			mu  sync.Mutex
+			ids []int
+		)
+		handler := func(_ context.Context, workerID int, msg parser.AntigravityMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ids = append(ids, msg.MessageID)
+			return nil
+		}
+		got := func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(ids)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		pool := pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1}, handler)
+		opts := parser.TailOptions{PollInterval: 20 * time.Millisecond, Checkpoints: checkpoints, Replay: replay}
+		Expect(parser.Tail(ctx, tempFile, opts, pool)).To(Succeed())
+		Eventually(got, "1s").Should(Equal(n))
+		Consistently(got, "100ms").Should(Equal(n))
+		cancel()
+		pool.Close()
+
+		mu.Lock()
+		defer mu.Unlock()
+		return ids
+	}
+
+	It("resumes after the last handled message on restart", func() {
+		Expect(run(2, false)).To(Equal([]int{0, 1}))
+
+		abs, _ := filepath.Abs(tempFile)
+		cp, err := checkpoints.LoadCheckpoint(abs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp.LastMessageID).To(Equal(1))
+
+		f, err := os.OpenFile(tempFile, os.O_APPEND|os.O_WRONLY, 0644)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = f.WriteString(`{"sessionId":"s","messageId":2}` + "\n")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		Expect(run(1, false)).To(Equal([]int{2}))
+	})
+
+	It("replays the whole log when asked to", func() {
+		run(2, false)
+		Expect(run(2, true)).To(Equal([]int{0, 1}))
+	})
+
+	It("starts over when the file at the path has been replaced", func() {
+		run(2, false)
+
+		replacement := tempFile + ".new"
+		Expect(os.WriteFile(replacement, []byte(`{"sessionId":"t","messageId":0}`+"\n"), 0644)).To(Succeed())
+		Expect(os.Rename(replacement, tempFile)).To(Succeed())
+
+		Expect(run(1, false)).To(Equal([]int{0}))
+	})
+})
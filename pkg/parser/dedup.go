@@ -0,0 +1,35 @@
+package parser
+
+import (
+	"strconv"
+	"time"
+)
+
+// DefaultDedupTTL is how long a message's dedup key is remembered when no
+// other TTL is configured.
+const DefaultDedupTTL = 24 * time.Hour
+
+// Deduper remembers which messages have already been handled, so that the
+// same message arriving twice, such as from a log that was truncated and
+// rewritten, is only emitted once.
+//
+// A tailer only claims a message once its handler has succeeded, so that a
+// message whose handling was cut short is delivered again after a restart.
+type Deduper interface {
+	// SeenMessages reports, in order, whether the DedupKey of each message
+	// has been claimed and not yet expired, without claiming anything.
+	SeenMessages(msgs []AntigravityMessage) ([]bool, error)
+	// ClaimMessages records the DedupKey of each message for ttl and reports,
+	// in order, whether each one was new. A key recorded earlier and not yet
+	// expired is reported as already seen and left unchanged.
+	ClaimMessages(msgs []AntigravityMessage, ttl time.Duration) ([]bool, error)
+}
+
+// DedupKey identifies msg for deduplication: by its client message id when
+// the sender supplied one, otherwise by its session and message id.
+func DedupKey(msg AntigravityMessage) string {
+	if msg.ClientMessageID != "" {
+		return "c:" + msg.SessionID + "/" + msg.ClientMessageID
+	}
+	return "m:" + msg.SessionID + "/" + strconv.Itoa(msg.MessageID)
+}
@@ -0,0 +1,168 @@
+package parser_test
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
+)
+
+// memDeduper is an in-memory parser.Deduper that never forgets.
+type memDeduper struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (m *memDeduper) SeenMessages(msgs []parser.AntigravityMessage) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	seen := make([]bool, len(msgs))
+	for i, msg := range msgs {
+		seen[i] = m.seen[parser.DedupKey(msg)]
+	}
+	return seen, nil
+}
+
+func (m *memDeduper) ClaimMessages(msgs []parser.AntigravityMessage, _ time.Duration) ([]bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fresh := make([]bool, len(msgs))
+	for i, msg := range msgs {
+		key := parser.DedupKey(msg)
+		fresh[i] = !m.seen[key]
+		m.seen[key] = true
+	}
+	return fresh, nil
+}
+
+var _ = Describe("Tailer Dedup", func() {
+	It("does not re-emit messages when a JSON log is truncated and rewritten", func() {
+		tempFile := filepath.Join(GinkgoT().TempDir(), "rewritten.json")
+		Expect(os.WriteFile(tempFile, []byte(`[
+			{"sessionId":"s","messageId":0},
+			{"sessionId":"s","messageId":1},
+			{"sessionId":"s","messageId":2}
+		]`), 0644)).To(Succeed())
+
+		var (
+			mu  sync.Mutex
+			ids []int
+		)
+		handler := func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			ids = append(ids, msg.MessageID)
+			return nil
+		}
+		got := func() []int {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]int(nil), ids...)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		pool := pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1}, handler)
+		DeferCleanup(pool.Close)
+
+		opts := parser.TailOptions{
+			Watch:        parser.WatchPoll,
+			PollInterval: 20 * time.Millisecond,
+			Dedup:        &memDeduper{seen: map[string]bool{}},
+		}
+		Expect(parser.Tail(ctx, tempFile, opts, pool)).To(Succeed())
+		Eventually(got, "1s").Should(Equal([]int{0, 1, 2}))
+
+		// The log is rewritten shorter, keeping an earlier message and
+		// adding a new one.
+		Expect(os.WriteFile(tempFile, []byte(`[
+			{"sessionId":"s","messageId":0},
+			{"sessionId":"s","messageId":3}
+		]`), 0644)).To(Succeed())
+
+		Eventually(got, "1s").Should(Equal([]int{0, 1, 2, 3}))
+		Consistently(got, "100ms").Should(Equal([]int{0, 1, 2, 3}))
+	})
+
+	It("delivers every message after a restart when tailing stopped mid-batch", func() {
+		tempFile := filepath.Join(GinkgoT().TempDir(), "interrupted.ndjson")
+		var lines string
+		for id := range 5 {
+			lines += fmt.Sprintf(`{"sessionId":"s","messageId":%d}`+"\n", id)
+		}
+		Expect(os.WriteFile(tempFile, []byte(lines), 0644)).To(Succeed())
+
+		var (
+			mu        sync.Mutex
+			delivered = map[int]bool{}
+			repeats   int
+		)
+		got := func() map[int]bool {
+			mu.Lock()
+			defer mu.Unlock()
+			return maps.Clone(delivered)
+		}
+		dedup := &memDeduper{seen: map[string]bool{}}
+		checkpoints := &memCheckpoints{cps: map[string]parser.Checkpoint{}}
+		opts := parser.TailOptions{
+			Watch:        parser.WatchPoll,
+			PollInterval: 20 * time.Millisecond,
+			Checkpoints:  checkpoints,
+			Dedup:        dedup,
+		}
+
+		// The first run handles message 0, then holds the only worker so
+		// that the batch backs up behind a one-message queue, and is
+		// stopped before the rest can be submitted.
+		ctx, cancel := context.WithCancel(context.Background())
+		started := make(chan struct{})
+		pool := pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1, QueueSize: 1},
+			func(ctx context.Context, _ int, msg parser.AntigravityMessage) error {
+				if msg.MessageID == 0 {
+					mu.Lock()
+					delivered[0] = true
+					mu.Unlock()
+					return nil
+				}
+				close(started)
+				<-ctx.Done()
+				return ctx.Err()
+			})
+		Expect(parser.Tail(ctx, tempFile, opts, pool)).To(Succeed())
+		Eventually(started, "1s").Should(BeClosed())
+		cancel()
+		pool.Close()
+		pool.Wait()
+		Expect(got()).To(Equal(map[int]bool{0: true}))
+
+		// The restart resumes from the old checkpoint, and dedup must only
+		// drop what was actually handled.
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		pool = pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1},
+			func(_ context.Context, _ int, msg parser.AntigravityMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				if delivered[msg.MessageID] {
+					repeats++
+				}
+				delivered[msg.MessageID] = true
+				return nil
+			})
+		DeferCleanup(pool.Close)
+		Expect(parser.Tail(ctx, tempFile, opts, pool)).To(Succeed())
+		Eventually(got, "1s").Should(Equal(map[int]bool{0: true, 1: true, 2: true, 3: true, 4: true}))
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(repeats).To(BeZero())
+	})
+})
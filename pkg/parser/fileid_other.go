@@ -0,0 +1,11 @@
+//go:build !unix
+
+package parser
+
+import "os"
+
+// fileIdentity is not available on this platform; rotation is then only
+// detected through truncation.
+func fileIdentity(info os.FileInfo) string {
+	return ""
+}
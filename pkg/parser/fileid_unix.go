@@ -0,0 +1,18 @@
+//go:build unix
+
+package parser
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns the device and inode of the file behind info.
+func fileIdentity(info os.FileInfo) string {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", st.Dev, st.Ino)
+}
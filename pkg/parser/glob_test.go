@@ -0,0 +1,133 @@
+package parser_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
+)
+
+var _ = Describe("Directory Tailer", func() {
+	var (
+		tempDir  string
+		ctx      context.Context
+		cancel   context.CancelFunc
+		mu       sync.Mutex
+		sessions map[string]int
+		errs     []error
+	)
+
+	BeforeEach(func() {
+		tempDir = GinkgoT().TempDir()
+		ctx, cancel = context.WithCancel(context.Background())
+		sessions = map[string]int{}
+		errs = nil
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	start := func(pattern string) {
+		pool := pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 2},
+			func(_ context.Context, workerID int, msg parser.AntigravityMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sessions[msg.SessionID]++
+				return nil
+			})
+		DeferCleanup(pool.Close)
+		opts := parser.TailOptions{
+			Watch:               parser.WatchPoll,
+			PollInterval:        20 * time.Millisecond,
+			SessionFromFileName: true,
+			OnError: func(path string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+			},
+		}
+		Expect(parser.TailGlob(ctx, pattern, opts, pool)).To(Succeed())
+	}
+
+	snapshot := func() map[string]int {
+		mu.Lock()
+		defer mu.Unlock()
+		out := map[string]int{}
+		for k, v := range sessions {
+			out[k] = v
+		}
+		return out
+	}
+
+	write := func(name, content string) {
+		Expect(os.WriteFile(filepath.Join(tempDir, name), []byte(content), 0644)).To(Succeed())
+	}
+
+	It("tails every log in a directory, including ones created later", func() {
+		write("alpha.ndjson", `{"messageId":0}`+"\n")
+		write("notes.txt", "not a log\n")
+		start(tempDir)
+
+		Eventually(snapshot, "1s").Should(Equal(map[string]int{"alpha": 1}))
+
+		write("beta.json", `[{"messageId":0},{"messageId":1}]`)
+		Eventually(snapshot, "1s").Should(Equal(map[string]int{"alpha": 1, "beta": 2}))
+	})
+
+	It("only follows files matching a glob", func() {
+		write("keep.ndjson", `{"messageId":0}`+"\n")
+		write("skip.json", `[{"messageId":0}]`)
+		start(filepath.Join(tempDir, "*.ndjson"))
+
+		Eventually(snapshot, "1s").Should(Equal(map[string]int{"keep": 1}))
+		Consistently(snapshot, "100ms").Should(Equal(map[string]int{"keep": 1}))
+	})
+
+	It("reports messages whose session id disagrees with the file name", func() {
+		write("gamma.ndjson", `{"sessionId":"other","messageId":0}`+"\n")
+		start(tempDir)
+
+		Eventually(snapshot, "1s").Should(Equal(map[string]int{"other": 1}))
+		mu.Lock()
+		defer mu.Unlock()
+		Expect(errs).To(HaveLen(1))
+		Expect(errs[0]).To(MatchError(ContainSubstring(`expected "gamma"`)))
+	})
+
+	It("polls at the default interval when none is given", func() {
+		write("delta.ndjson", `{"sessionId":"delta","messageId":0}`+"\n")
+		pool := pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1},
+			func(_ context.Context, workerID int, msg parser.AntigravityMessage) error {
+				mu.Lock()
+				defer mu.Unlock()
+				sessions[msg.SessionID]++
+				return nil
+			})
+		DeferCleanup(pool.Close)
+		Expect(parser.TailGlob(ctx, tempDir, parser.TailOptions{}, pool)).To(Succeed())
+		Eventually(snapshot, "1s").Should(Equal(map[string]int{"delta": 1}))
+
+		// A zero interval would panic in the ticker; the default picks new
+		// logs up within a tick.
+		write("epsilon.ndjson", `{"sessionId":"epsilon","messageId":0}`+"\n")
+		Eventually(snapshot, 2*parser.DefaultPollInterval+time.Second).Should(HaveKeyWithValue("epsilon", 1))
+
+		// Likewise for a single log followed by polling.
+		polled := filepath.Join(GinkgoT().TempDir(), "zeta.ndjson")
+		Expect(parser.Tail(ctx, polled, parser.TailOptions{Watch: parser.WatchPoll}, pool)).To(Succeed())
+		Expect(os.WriteFile(polled, []byte(`{"sessionId":"zeta","messageId":0}`+"\n"), 0644)).To(Succeed())
+		Eventually(snapshot, 2*parser.DefaultPollInterval+time.Second).Should(HaveKeyWithValue("zeta", 1))
+	})
+
+	It("rejects a malformed pattern", func() {
+		Expect(parser.TailGlob(ctx, "[", parser.TailOptions{PollInterval: time.Second}, nil)).NotTo(Succeed())
+	})
+})
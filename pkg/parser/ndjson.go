@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ParseNDJSON decodes a line-delimited JSON stream where each non-blank line
+// is one AntigravityMessage.
+func ParseNDJSON(r io.Reader) ([]AntigravityMessage, error) {
+	var messages []AntigravityMessage
+	err := ParseNDJSONStream(r, func(msg AntigravityMessage) error {
+		messages = append(messages, msg)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// ParseNDJSONStream decodes r line by line, calling fn for each message. If fn
+// returns an error, decoding stops and that error is returned unchanged.
+func ParseNDJSONStream(r io.Reader, fn func(AntigravityMessage) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), MaxNDJSONLine)
+	line := 0
+	for scanner.Scan() {
+		line++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var msg AntigravityMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// ParseNDJSONLog reads the provided NDJSON log file and decodes every line.
+func ParseNDJSONLog(filePath string) ([]AntigravityMessage, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ParseNDJSON(file)
+}
+
+// ParseNDJSONFileStream opens filePath and streams it through ParseNDJSONStream.
+func ParseNDJSONFileStream(filePath string, fn func(AntigravityMessage) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ParseNDJSONStream(file, fn)
+}
+
+// MaxNDJSONLine bounds a single NDJSON line, in a log or an ingested batch,
+// so a corrupt input cannot exhaust memory.
+const MaxNDJSONLine = 16 * 1024 * 1024
+
+// readNDJSONFrom decodes the complete lines of filePath starting at byte
+// offset. A trailing line without its newline is left for the next call, as
+// the writer is probably still mid-write. It returns the decoded messages and
+// the number of bytes consumed. Lines that fail to decode are skipped after
+// being passed to onBadLine, if set, with the byte offset they start at.
+func readNDJSONFrom(filePath string, offset int64, onBadLine func(offset int64, err error)) ([]AntigravityMessage, int64, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	var (
+		messages []AntigravityMessage
+		consumed int64
+	)
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return messages, consumed, nil
+		}
+		if err != nil {
+			return messages, consumed, err
+		}
+		start := offset + consumed
+		consumed += int64(len(line))
+
+		raw := bytes.TrimSpace(line)
+		if len(raw) == 0 {
+			continue
+		}
+		var msg AntigravityMessage
+		if err := json.Unmarshal(raw, &msg); err != nil {
+			if onBadLine != nil {
+				onBadLine(start, err)
+			}
+			continue
+		}
+		messages = append(messages, msg)
+	}
+}
+
+// LogFormat identifies how a chat log file is encoded.
+type LogFormat string
+
+const (
+	// FormatJSON is a single JSON array of messages.
+	FormatJSON LogFormat = "json"
+	// FormatNDJSON is one JSON message per line.
+	FormatNDJSON LogFormat = "ndjson"
+)
+
+// DetectFormat guesses a log's format from its file extension, treating
+// .ndjson and .jsonl as NDJSON and anything else as a JSON array.
+func DetectFormat(filePath string) LogFormat {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	default:
+		return FormatJSON
+	}
+}
@@ -0,0 +1,130 @@
+package parser_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
+)
+
+var _ = Describe("NDJSON Logs", func() {
+	It("parses one message per line, skipping blank lines", func() {
+		input := `{"sessionId":"s1","messageId":0,"type":"user","message":"one"}
+
+{"sessionId":"s1","messageId":1,"type":"system","message":"two"}
+`
+		messages, err := parser.ParseNDJSON(strings.NewReader(input))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[1].Message).To(Equal("two"))
+	})
+
+	It("reports the line number of a malformed entry", func() {
+		_, err := parser.ParseNDJSON(strings.NewReader("{\"messageId\":0}\nnot json\n"))
+		Expect(err).To(MatchError(ContainSubstring("line 2")))
+	})
+
+	It("detects the format from the file extension", func() {
+		Expect(parser.DetectFormat("chat.ndjson")).To(Equal(parser.FormatNDJSON))
+		Expect(parser.DetectFormat("chat.JSONL")).To(Equal(parser.FormatNDJSON))
+		Expect(parser.DetectFormat("logs.json")).To(Equal(parser.FormatJSON))
+	})
+
+	Describe("tailing", func() {
+		var (
+			tempFile string
+			done     chan struct{}
+			received atomic.Int32
+		)
+
+		BeforeEach(func() {
+			tempFile = filepath.Join(GinkgoT().TempDir(), "tail.ndjson")
+			done = make(chan struct{})
+			received.Store(0)
+			Expect(os.WriteFile(tempFile, nil, 0644)).To(Succeed())
+
+			handler := func(workerID int, msg parser.AntigravityMessage) {
+				received.Add(1)
+			}
+			Expect(parser.TailNDJSONLog(tempFile, 20*time.Millisecond, 2, handler, done)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			close(done)
+		})
+
+		appendLine := func(s string) {
+			f, err := os.OpenFile(tempFile, os.O_APPEND|os.O_WRONLY, 0644)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = f.WriteString(s)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(f.Close()).To(Succeed())
+		}
+
+		count := func() int32 { return received.Load() }
+
+		It("only decodes lines appended since the last read", func() {
+			appendLine(`{"sessionId":"s1","messageId":0,"message":"a"}` + "\n")
+			Eventually(count, "1s").Should(BeEquivalentTo(1))
+
+			appendLine(`{"sessionId":"s1","messageId":1,"message":"b"}` + "\n")
+			Eventually(count, "1s").Should(BeEquivalentTo(2))
+			Consistently(count, "100ms").Should(BeEquivalentTo(2))
+		})
+
+		It("waits for a partially written line to be completed", func() {
+			appendLine(`{"sessionId":"s1","messageId":0,`)
+			Consistently(count, "100ms").Should(BeEquivalentTo(0))
+
+			appendLine(`"message":"a"}` + "\n")
+			Eventually(count, "1s").Should(BeEquivalentTo(1))
+		})
+
+		It("starts over when the file is truncated", func() {
+			appendLine(`{"sessionId":"s1","messageId":0,"message":"a"}` + "\n" +
+				`{"sessionId":"s1","messageId":1,"message":"b"}` + "\n")
+			Eventually(count, "1s").Should(BeEquivalentTo(2))
+
+			Expect(os.WriteFile(tempFile, []byte(`{"sessionId":"s2","messageId":0}`+"\n"), 0644)).To(Succeed())
+			Eventually(count, "1s").Should(BeEquivalentTo(3))
+		})
+	})
+
+	It("reports and skips a line that does not decode", func() {
+		tempFile := filepath.Join(GinkgoT().TempDir(), "corrupt.ndjson")
+		good := `{"sessionId":"s1","messageId":0}` + "\n"
+		Expect(os.WriteFile(tempFile, []byte(good+"not json\n"+`{"sessionId":"s1","messageId":1}`+"\n"), 0644)).To(Succeed())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		DeferCleanup(cancel)
+		var received atomic.Int32
+		pool := pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1},
+			func(_ context.Context, _ int, _ parser.AntigravityMessage) error {
+				received.Add(1)
+				return nil
+			})
+		DeferCleanup(pool.Close)
+		errs := make(chan error, 10)
+		opts := parser.TailOptions{
+			Watch:        parser.WatchPoll,
+			PollInterval: 20 * time.Millisecond,
+			OnError:      func(_ string, err error) { errs <- err },
+		}
+		Expect(parser.Tail(ctx, tempFile, opts, pool)).To(Succeed())
+
+		Eventually(received.Load, "1s").Should(BeEquivalentTo(2))
+		var err error
+		Eventually(errs, "1s").Should(Receive(&err))
+		Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("at byte %d", len(good)))))
+		Consistently(errs, "100ms").ShouldNot(Receive())
+	})
+})
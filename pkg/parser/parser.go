@@ -2,6 +2,7 @@ package parser
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"time"
@@ -15,6 +16,19 @@ type AntigravityMessage struct {
 	User      string    `json:"user,omitempty"`
 	Message   string    `json:"message"`
 	Timestamp time.Time `json:"timestamp"`
+
+	// The fields below are optional context supplied by clients of the
+	// ingestion API; Antigravity's own logs do not carry them.
+
+	// ClientMessageID is the sender's own id for the message.
+	ClientMessageID string `json:"clientMessageId,omitempty"`
+	// ReplyTo is the ClientMessageID of the message this one answers.
+	ReplyTo string `json:"replyTo,omitempty"`
+	// Channel and Thread place the message within the sender's chat tool.
+	Channel string `json:"channel,omitempty"`
+	Thread  string `json:"thread,omitempty"`
+	// Metadata holds any other key/value pairs the sender attached.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 // ParseChatLog reads the provided Antigravity JSON log file and unmarshals it.
@@ -38,3 +52,46 @@ func ParseChatLog(filePath string) ([]AntigravityMessage, error) {
 
 	return messages, nil
 }
+
+// ParseChatLogStream decodes an Antigravity JSON array from r one element at a
+// time, calling fn for each message as soon as it has been decoded. Memory use
+// is bounded by the largest single message rather than the whole log. If fn
+// returns an error, decoding stops and that error is returned unchanged.
+func ParseChatLogStream(r io.Reader, fn func(AntigravityMessage) error) error {
+	dec := json.NewDecoder(r)
+
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("expected JSON array, got %v", tok)
+	}
+
+	for index := 0; dec.More(); index++ {
+		var msg AntigravityMessage
+		if err := dec.Decode(&msg); err != nil {
+			return fmt.Errorf("message %d: %w", index, err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing bracket so truncated input is reported.
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ParseChatLogFileStream opens filePath and streams it through ParseChatLogStream.
+func ParseChatLogFileStream(filePath string, fn func(AntigravityMessage) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return ParseChatLogStream(file, fn)
+}
@@ -1,8 +1,10 @@
 package parser_test
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -58,6 +60,45 @@ var _ = Describe("JSON Parser", func() {
 		Expect(messages[1].Message).To(Equal("Yes, I can!"))
 	})
 
+	It("streams messages one at a time from a JSON array", func() {
+		var seen []int
+		err := parser.ParseChatLogFileStream(tempFile, func(msg parser.AntigravityMessage) error {
+			seen = append(seen, msg.MessageID)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seen).To(Equal([]int{0, 1}))
+	})
+
+	It("delivers messages before the end of a truncated stream", func() {
+		input := `[{"sessionId":"s","messageId":0,"message":"ok"},{"sessionId":"s","messageId":1,"mess`
+		var seen []int
+		err := parser.ParseChatLogStream(strings.NewReader(input), func(msg parser.AntigravityMessage) error {
+			seen = append(seen, msg.MessageID)
+			return nil
+		})
+		Expect(err).To(HaveOccurred())
+		Expect(seen).To(Equal([]int{0}))
+	})
+
+	It("stops streaming when the callback returns an error", func() {
+		stop := errors.New("stop")
+		calls := 0
+		err := parser.ParseChatLogFileStream(tempFile, func(msg parser.AntigravityMessage) error {
+			calls++
+			return stop
+		})
+		Expect(err).To(Equal(stop))
+		Expect(calls).To(Equal(1))
+	})
+
+	It("rejects input that is not a JSON array", func() {
+		err := parser.ParseChatLogStream(strings.NewReader(`{"messageId":0}`), func(parser.AntigravityMessage) error {
+			return nil
+		})
+		Expect(err).To(MatchError(ContainSubstring("expected JSON array")))
+	})
+
 	It("returns an error for a non-existent file", func() {
 		_, err := parser.ParseChatLog("does_not_exist.json")
 		Expect(err).To(HaveOccurred())
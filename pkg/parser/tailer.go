@@ -1,74 +1,531 @@
 package parser
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/gnomatix/enkente/pkg/pipeline"
 )
 
+// DefaultPollInterval is how often a log is polled when no other interval is
+// configured.
+const DefaultPollInterval = 500 * time.Millisecond
+
+// TailOptions configures Tail.
+type TailOptions struct {
+	// Format of the log; empty means DetectFormat from the file name.
+	Format LogFormat
+	// Watch selects filesystem notifications or polling; see WatchMode.
+	Watch WatchMode
+	// PollInterval is how often the file is checked for changes when
+	// polling; zero means DefaultPollInterval.
+	PollInterval time.Duration
+	// Checkpoints, if set, persists the tailer's position so a restart
+	// resumes after the last handled message instead of replaying the log.
+	Checkpoints CheckpointStore
+	// Replay ignores any saved checkpoint and processes the log from the
+	// start. Replayed messages are still recorded with Dedup but not
+	// filtered by it.
+	Replay bool
+	// Dedup, if set, records every message handled and drops those it has
+	// seen before, so a log that is truncated and rewritten with earlier
+	// messages does not emit them again.
+	Dedup Deduper
+	// DedupTTL is how long Dedup remembers a message; zero means
+	// DefaultDedupTTL.
+	DedupTTL time.Duration
+	// SessionFromFileName treats each log's file name as its session id,
+	// filling it into messages that lack one and reporting those that
+	// disagree through OnError.
+	SessionFromFileName bool
+	// OnError, if set, is told about problems that do not stop tailing, such
+	// as a checkpoint that could not be saved or an NDJSON line that does not
+	// decode.
+	OnError func(path string, err error)
+}
+
 // TailChatLog watches a given Antigravity JSON log file and streams new messages to the returned channel.
 // It also spins up `numWorkers` goroutines to process incoming messages concurrently using the provided `handler`.
 // It stops if the done channel is closed.
 func TailChatLog(filePath string, pollInterval time.Duration, numWorkers int, handler func(workerID int, msg AntigravityMessage), done <-chan struct{}) error {
-	out := make(chan AntigravityMessage, 100) // Buffer the channel to prevent blocking on fast writes
-
-	// Worker swarm: start the specified number of goroutines
-	for i := 0; i < numWorkers; i++ {
-		workerID := i
-		go func() {
-			for msg := range out {
-				handler(workerID, msg)
-			}
-		}()
+	return tailWithWorkers(filePath, TailOptions{Format: FormatJSON, PollInterval: pollInterval}, numWorkers, handler, done)
+}
+
+// TailNDJSONLog is the NDJSON counterpart of TailChatLog. Rather than
+// re-parsing the whole file on every change it remembers the byte offset it
+// has read up to and only decodes lines appended since. If the file shrinks
+// below that offset it is assumed to have been truncated and is read again
+// from the start.
+func TailNDJSONLog(filePath string, pollInterval time.Duration, numWorkers int, handler func(workerID int, msg AntigravityMessage), done <-chan struct{}) error {
+	return tailWithWorkers(filePath, TailOptions{Format: FormatNDJSON, PollInterval: pollInterval}, numWorkers, handler, done)
+}
+
+// tailWithWorkers runs Tail on a pool of its own, closing it once done is
+// closed and the queued messages have drained.
+func tailWithWorkers(filePath string, opts TailOptions, numWorkers int, handler func(workerID int, msg AntigravityMessage), done <-chan struct{}) error {
+	pool := pipeline.New(context.Background(), pipeline.Config[AntigravityMessage]{Workers: numWorkers},
+		func(_ context.Context, workerID int, msg AntigravityMessage) error {
+			handler(workerID, msg)
+			return nil
+		})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := Tail(ctx, filePath, opts, pool); err != nil {
+		cancel()
+		pool.Close()
+		return err
+	}
+	go func() {
+		<-done
+		cancel()
+		pool.Close()
+	}()
+	return nil
+}
+
+// SessionKey is a pipeline.Config Key that keeps each session's messages in
+// order on one worker.
+func SessionKey(msg AntigravityMessage) string {
+	return msg.SessionID
+}
+
+// Tail watches a chat log and submits every new message to pool until ctx is
+// done. The pool belongs to the caller, who closes it once tailing has
+// stopped. With a CheckpointStore configured, the position is saved once each
+// batch of new messages has been handled.
+func Tail(ctx context.Context, filePath string, opts TailOptions, pool *pipeline.Pool[AntigravityMessage]) error {
+	f, err := openFollower(filePath, opts)
+	if err != nil {
+		return err
 	}
 
 	// Tailing routine
+	go f.run(ctx, pool)
+
+	return nil
+}
+
+// TailGlob tails every log file matching pattern, which may also name a
+// directory to tail all .json, .ndjson and .jsonl files in it. The pattern is
+// re-evaluated every PollInterval so logs created later are picked up too.
+// All files feed the same pool and each keeps its own checkpoint.
+func TailGlob(ctx context.Context, pattern string, opts TailOptions, pool *pipeline.Pool[AntigravityMessage]) error {
+	onlyLogs := false
+	if info, err := os.Stat(pattern); err == nil && info.IsDir() {
+		pattern = filepath.Join(pattern, "*")
+		onlyLogs = true
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	opts = opts.withDefaults()
+
 	go func() {
-		defer close(out)
+		tailing := map[string]bool{}
+		scan := func() {
+			matches, _ := filepath.Glob(pattern)
+			for _, path := range matches {
+				if tailing[path] || (onlyLogs && !isLogFile(path)) {
+					continue
+				}
+				if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+					continue
+				}
 
-		lastModTime := time.Time{}
-		lastProcessedIndex := 0
+				f, err := openFollower(path, opts)
+				if err != nil {
+					// Try again on the next scan.
+					opts.reportError(path, err)
+					continue
+				}
+				tailing[path] = true
+				go f.run(ctx, pool)
+			}
+		}
 
-		ticker := time.NewTicker(pollInterval)
+		ticker := time.NewTicker(opts.PollInterval)
 		defer ticker.Stop()
 
+		scan()
 		for {
 			select {
-			case <-done:
+			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				info, err := os.Stat(filePath)
-				if err != nil {
-					// File might not exist yet; ignore and continue polling
-					continue
-				}
-
-				if info.ModTime().After(lastModTime) {
-					lastModTime = info.ModTime()
-
-					messages, err := ParseChatLog(filePath)
-					if err != nil {
-						// Malformed JSON (perhaps caught mid-write), we'll try again next tick
-						continue
-					}
-
-					// If new messages were added
-					if len(messages) > lastProcessedIndex {
-						for _, msg := range messages[lastProcessedIndex:] {
-							out <- msg
-						}
-						lastProcessedIndex = len(messages)
-					} else if len(messages) < lastProcessedIndex {
-						// File was truncated or rotated
-						lastProcessedIndex = 0
-						for _, msg := range messages {
-							out <- msg
-						}
-						lastProcessedIndex = len(messages)
-					}
-				}
+				scan()
 			}
 		}
 	}()
 
 	return nil
 }
+
+// SessionIDFromPath derives a session id from a log's file name, which
+// Antigravity names after the conversation: /logs/1ee3cafd.json -> 1ee3cafd.
+func SessionIDFromPath(filePath string) string {
+	base := filepath.Base(filePath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func isLogFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json", ".ndjson", ".jsonl":
+		return true
+	}
+	return false
+}
+
+// withDefaults fills in the options left at zero that cannot stay zero.
+func (opts TailOptions) withDefaults() TailOptions {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	return opts
+}
+
+func (opts TailOptions) reportError(path string, err error) {
+	if opts.OnError != nil {
+		opts.OnError(path, err)
+	}
+}
+
+// openFollower prepares a follower for filePath, restoring its checkpoint
+// and setting up filesystem notifications as configured.
+func openFollower(filePath string, opts TailOptions) (*follower, error) {
+	f, err := newFollower(filePath, opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	opts = opts.withDefaults()
+	f.opts = opts
+	if opts.SessionFromFileName {
+		f.sessionID = SessionIDFromPath(f.path)
+	}
+
+	if opts.Checkpoints != nil && !opts.Replay {
+		cp, err := opts.Checkpoints.LoadCheckpoint(f.path)
+		if err != nil {
+			return nil, err
+		}
+		if cp != nil {
+			f.restore(*cp)
+		}
+	}
+
+	if opts.Watch != WatchPoll {
+		f.watcher, err = newNotifier(f.path)
+		if err != nil && opts.Watch == WatchNotify {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+// run follows the file, submitting new messages to pool until ctx is done.
+func (f *follower) run(ctx context.Context, pool *pipeline.Pool[AntigravityMessage]) {
+	var (
+		events <-chan struct{}
+		ticker *time.Ticker
+		tick   <-chan time.Time
+	)
+	startPolling := func() {
+		ticker = time.NewTicker(f.opts.PollInterval)
+		tick = ticker.C
+	}
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	if f.watcher != nil {
+		defer f.watcher.Close()
+		events = f.watcher.Events()
+		// Anything that happened before the first read below is
+		// already reflected in it.
+		f.watcher.Replaced()
+	} else {
+		startPolling()
+	}
+
+	// dispatch reports false once the pool no longer accepts messages.
+	dispatch := func(messages []AntigravityMessage) bool {
+		if len(messages) == 0 {
+			return true
+		}
+		for i := range messages {
+			messages[i] = f.checkSession(messages[i])
+		}
+		messages = f.dedup(messages)
+
+		var batch sync.WaitGroup
+		for _, msg := range messages {
+			batch.Add(1)
+			err := pool.SubmitFunc(ctx, msg, func(err error) {
+				defer batch.Done()
+				if err == nil {
+					f.claim(msg)
+				}
+			})
+			if err != nil {
+				// Stopped mid-batch; the rest is picked up from the last
+				// saved checkpoint next time.
+				batch.Done()
+				return false
+			}
+		}
+
+		if f.opts.Checkpoints != nil {
+			batch.Wait()
+			// A failed save only means the batch may be replayed after
+			// a restart; keep tailing.
+			if err := f.opts.Checkpoints.SaveCheckpoint(f.checkpoint()); err != nil {
+				f.opts.reportError(f.path, fmt.Errorf("save checkpoint: %w", err))
+			}
+		}
+		return true
+	}
+
+	// Pick up whatever is already in the file before waiting for changes.
+	if !dispatch(f.poll(true, false)) {
+		return
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case _, ok := <-events:
+			if !ok {
+				// The notifier died (e.g. the directory was removed);
+				// carry on by polling.
+				events = nil
+				startPolling()
+				continue
+			}
+			if !dispatch(f.poll(true, f.watcher.Replaced())) {
+				return
+			}
+		case <-tick:
+			if !dispatch(f.poll(false, false)) {
+				return
+			}
+		}
+	}
+}
+
+// checkSession fills in a missing session id from the file name and reports
+// messages whose own id disagrees with it.
+func (f *follower) checkSession(msg AntigravityMessage) AntigravityMessage {
+	switch {
+	case f.sessionID == "":
+	case msg.SessionID == "":
+		msg.SessionID = f.sessionID
+	case msg.SessionID != f.sessionID:
+		f.opts.reportError(f.path, fmt.Errorf("message %d has session id %q, expected %q from the file name",
+			msg.MessageID, msg.SessionID, f.sessionID))
+	}
+	return msg
+}
+
+// dedup drops the messages that Dedup has seen before, and repeats within
+// the batch. Nothing is claimed here: see claim. If Dedup fails the messages
+// are all passed on, since a duplicate is better than a loss.
+func (f *follower) dedup(messages []AntigravityMessage) []AntigravityMessage {
+	if f.opts.Dedup == nil || f.opts.Replay {
+		return messages
+	}
+	seen, err := f.opts.Dedup.SeenMessages(messages)
+	if err != nil {
+		f.opts.reportError(f.path, fmt.Errorf("dedup: %w", err))
+		return messages
+	}
+	kept := messages[:0]
+	batch := map[string]bool{}
+	for i, msg := range messages {
+		key := DedupKey(msg)
+		if seen[i] || batch[key] {
+			continue
+		}
+		batch[key] = true
+		kept = append(kept, msg)
+	}
+	return kept
+}
+
+// claim records with Dedup that msg has been handled. It is only called once
+// the handler has succeeded, so a message lost to a stop mid-batch or a
+// crash is not taken for a duplicate when the log is read again.
+func (f *follower) claim(msg AntigravityMessage) {
+	if f.opts.Dedup == nil {
+		return
+	}
+	ttl := f.opts.DedupTTL
+	if ttl <= 0 {
+		ttl = DefaultDedupTTL
+	}
+	if _, err := f.opts.Dedup.ClaimMessages([]AntigravityMessage{msg}, ttl); err != nil {
+		f.opts.reportError(f.path, fmt.Errorf("dedup: %w", err))
+	}
+}
+
+// follower tracks how far one log file has been read.
+type follower struct {
+	path      string
+	format    LogFormat
+	opts      TailOptions
+	watcher   notifier
+	sessionID string // expected session, if derived from the file name
+
+	fileID        string
+	lastModTime   time.Time
+	lastSize      int64
+	offset        int64 // NDJSON: bytes consumed
+	index         int   // JSON array: elements consumed
+	lastMessageID int
+}
+
+func newFollower(filePath string, format LogFormat) (*follower, error) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if format == "" {
+		format = DetectFormat(abs)
+	}
+	return &follower{path: abs, format: format, lastMessageID: -1}, nil
+}
+
+// poll checks the file once and returns any messages added since the last
+// call. notified means a filesystem event reported a change, so the JSON
+// array log is re-read even if its mtime and size look unchanged; replaced
+// means the event showed a different file now lives at the path.
+func (f *follower) poll(notified, replaced bool) []AntigravityMessage {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if os.IsNotExist(err) && f.fileID != "" {
+			// The log was deleted or moved away; whatever appears here next
+			// is a new file.
+			f.reset()
+			f.fileID = ""
+		}
+		// File might not exist yet; ignore and continue polling
+		return nil
+	}
+
+	var messages []AntigravityMessage
+	switch f.format {
+	case FormatNDJSON:
+		// NDJSON logs are append-only, so a different file at this path
+		// means the log was rotated or recreated and must be read from the
+		// start. JSON array logs are often saved by writing a new file and
+		// renaming it over the old one, so there the element count alone
+		// decides what is new.
+		if id := fileIdentity(info); id != f.fileID || replaced {
+			if f.fileID != "" {
+				f.reset()
+			}
+			f.fileID = id
+		}
+		messages = f.pollNDJSON(info)
+	default:
+		f.fileID = fileIdentity(info)
+		messages = f.pollJSON(info, notified)
+	}
+
+	if n := len(messages); n > 0 {
+		f.lastMessageID = messages[n-1].MessageID
+	}
+	return messages
+}
+
+func (f *follower) pollJSON(info os.FileInfo, notified bool) []AntigravityMessage {
+	// Size is checked as well as mtime since several writes can land within
+	// one tick of the filesystem's timestamp granularity.
+	if !notified && !info.ModTime().After(f.lastModTime) && info.Size() == f.lastSize {
+		return nil
+	}
+	f.lastModTime = info.ModTime()
+	f.lastSize = info.Size()
+
+	// Stream the log so only messages past the current index are held in
+	// memory, and nothing is sent until the whole file decodes cleanly.
+	var pending []AntigravityMessage
+	total := 0
+	err := ParseChatLogFileStream(f.path, func(msg AntigravityMessage) error {
+		if total >= f.index {
+			pending = append(pending, msg)
+		}
+		total++
+		return nil
+	})
+	if err != nil {
+		// Malformed JSON (perhaps caught mid-write), we'll try again next tick
+		f.lastModTime = time.Time{}
+		return nil
+	}
+
+	if total < f.index {
+		// File was truncated or rotated; re-read it from the start
+		pending = nil
+		err := ParseChatLogFileStream(f.path, func(msg AntigravityMessage) error {
+			pending = append(pending, msg)
+			return nil
+		})
+		if err != nil {
+			f.lastModTime = time.Time{}
+			return nil
+		}
+	}
+
+	f.index = total
+	return pending
+}
+
+func (f *follower) pollNDJSON(info os.FileInfo) []AntigravityMessage {
+	if info.Size() < f.offset {
+		// File was truncated or rotated
+		f.offset = 0
+	}
+	if info.Size() == f.offset {
+		return nil
+	}
+
+	messages, n, err := readNDJSONFrom(f.path, f.offset, func(offset int64, err error) {
+		f.opts.reportError(f.path, fmt.Errorf("skipped undecodable line at byte %d: %w", offset, err))
+	})
+	if err != nil {
+		return nil
+	}
+	f.offset += n
+	return messages
+}
+
+func (f *follower) reset() {
+	f.lastModTime = time.Time{}
+	f.lastSize = 0
+	f.offset = 0
+	f.index = 0
+}
+
+func (f *follower) checkpoint() Checkpoint {
+	return Checkpoint{
+		Path:          f.path,
+		FileID:        f.fileID,
+		Offset:        f.offset,
+		Index:         f.index,
+		LastMessageID: f.lastMessageID,
+		UpdatedAt:     time.Now().UTC(),
+	}
+}
+
+func (f *follower) restore(cp Checkpoint) {
+	f.fileID = cp.FileID
+	f.offset = cp.Offset
+	f.index = cp.Index
+	f.lastMessageID = cp.LastMessageID
+}
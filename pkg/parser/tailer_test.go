@@ -1,14 +1,18 @@
 package parser_test
 
 import (
+	"context"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync/atomic"
 	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
 	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/pipeline"
 )
 
 var _ = Describe("Live Tailer", func() {
@@ -80,3 +84,96 @@ var _ = Describe("Live Tailer", func() {
 		Consistently(func() int { return processedCount }, "200ms").Should(Equal(2))
 	})
 })
+
+var _ = Describe("Event-driven Tailer", func() {
+	var (
+		tempDir  string
+		tempFile string
+		ctx      context.Context
+		cancel   context.CancelFunc
+		pool     *pipeline.Pool[parser.AntigravityMessage]
+		received atomic.Int32
+	)
+
+	BeforeEach(func() {
+		if runtime.GOOS != "linux" {
+			Skip("filesystem notifications are only implemented on Linux")
+		}
+		tempDir = GinkgoT().TempDir()
+		tempFile = filepath.Join(tempDir, "watched.ndjson")
+		received.Store(0)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		pool = pipeline.New(ctx, pipeline.Config[parser.AntigravityMessage]{Workers: 1},
+			func(_ context.Context, workerID int, msg parser.AntigravityMessage) error {
+				received.Add(1)
+				return nil
+			})
+		DeferCleanup(pool.Close)
+		// An hour-long poll interval proves changes arrive through inotify.
+		opts := parser.TailOptions{Watch: parser.WatchNotify, PollInterval: time.Hour}
+		Expect(parser.Tail(ctx, tempFile, opts, pool)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		if cancel != nil {
+			cancel()
+		}
+	})
+
+	count := func() int32 { return received.Load() }
+
+	It("notices a log created after tailing started", func() {
+		Expect(os.WriteFile(tempFile, []byte(`{"sessionId":"s","messageId":0}`+"\n"), 0644)).To(Succeed())
+		Eventually(count, "1s").Should(BeEquivalentTo(1))
+	})
+
+	It("reads a log rotated into place from the start", func() {
+		Expect(os.WriteFile(tempFile, []byte(`{"sessionId":"s","messageId":0}`+"\n"+`{"sessionId":"s","messageId":1}`+"\n"), 0644)).To(Succeed())
+		Eventually(count, "1s").Should(BeEquivalentTo(2))
+
+		rotated := filepath.Join(tempDir, "next.ndjson")
+		Expect(os.WriteFile(rotated, []byte(`{"sessionId":"t","messageId":0}`+"\n"+`{"sessionId":"t","messageId":1}`+"\n"+`{"sessionId":"t","messageId":2}`+"\n"), 0644)).To(Succeed())
+		Expect(os.Rename(rotated, tempFile)).To(Succeed())
+		Eventually(count, "1s").Should(BeEquivalentTo(5))
+	})
+
+	It("picks the log up again after it is deleted and recreated", func() {
+		Expect(os.WriteFile(tempFile, []byte(`{"sessionId":"s","messageId":0}`+"\n"), 0644)).To(Succeed())
+		Eventually(count, "1s").Should(BeEquivalentTo(1))
+
+		Expect(os.Remove(tempFile)).To(Succeed())
+		Expect(os.WriteFile(tempFile, []byte(`{"sessionId":"s","messageId":0}`+"\n"), 0644)).To(Succeed())
+		Eventually(count, "1s").Should(BeEquivalentTo(2))
+	})
+
+	It("shares one inotify instance among the logs of a directory", func() {
+		// Followers of earlier specs may still be closing theirs.
+		Eventually(inotifyInstances, "1s").Should(Equal(1))
+
+		opts := parser.TailOptions{Watch: parser.WatchNotify, PollInterval: time.Hour}
+		for _, name := range []string{"a.ndjson", "b.ndjson", "c.ndjson"} {
+			Expect(parser.Tail(ctx, filepath.Join(tempDir, name), opts, pool)).To(Succeed())
+		}
+		Expect(inotifyInstances()).To(Equal(1))
+
+		for _, name := range []string{"a.ndjson", "b.ndjson", "c.ndjson"} {
+			Expect(os.WriteFile(filepath.Join(tempDir, name), []byte(`{"sessionId":"s","messageId":0}`+"\n"), 0644)).To(Succeed())
+		}
+		Eventually(count, "1s").Should(BeEquivalentTo(3))
+		Consistently(count, "100ms").Should(BeEquivalentTo(3))
+	})
+})
+
+// inotifyInstances counts the inotify descriptors this process has open.
+func inotifyInstances() int {
+	fds, err := os.ReadDir("/proc/self/fd")
+	Expect(err).NotTo(HaveOccurred())
+	n := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && target == "anon_inode:inotify" {
+			n++
+		}
+	}
+	return n
+}
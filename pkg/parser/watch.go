@@ -0,0 +1,41 @@
+package parser
+
+import "fmt"
+
+// WatchMode selects how a tailer notices that a log file has changed.
+type WatchMode string
+
+const (
+	// WatchAuto uses filesystem notifications where available and falls back
+	// to polling otherwise.
+	WatchAuto WatchMode = ""
+	// WatchPoll checks the file every PollInterval.
+	WatchPoll WatchMode = "poll"
+	// WatchNotify requires filesystem notifications (inotify on Linux).
+	WatchNotify WatchMode = "notify"
+)
+
+// ParseWatchMode converts a flag value into a WatchMode.
+func ParseWatchMode(s string) (WatchMode, error) {
+	switch s {
+	case "", "auto":
+		return WatchAuto, nil
+	case string(WatchPoll):
+		return WatchPoll, nil
+	case string(WatchNotify):
+		return WatchNotify, nil
+	}
+	return "", fmt.Errorf("unknown watch mode %q (want auto, poll or notify)", s)
+}
+
+// notifier signals changes to a watched path. Bursts of filesystem events are
+// coalesced into a single pending signal. Events is closed if the notifier
+// stops working, e.g. because the watched directory was removed.
+type notifier interface {
+	Events() <-chan struct{}
+	// Replaced reports, and clears, whether the file has been deleted or
+	// renamed away since the last call. Inode numbers are often reused
+	// straight away, so this is the only reliable sign of a delete-and-recreate.
+	Replaced() bool
+	Close() error
+}
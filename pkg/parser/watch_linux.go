@@ -0,0 +1,229 @@
+//go:build linux
+
+package parser
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// The parent directory is watched rather than the file itself, so creation,
+// rename-over and deletion of the log are seen as well as writes to it.
+const inotifyMask = syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO |
+	syscall.IN_DELETE_SELF | syscall.IN_MOVE_SELF
+
+// goneMask marks events after which the file previously at the watched path
+// no longer lives there. A file renamed over it gets a new inode anyway, so
+// IN_MOVED_TO is caught by the identity check instead.
+const goneMask = syscall.IN_DELETE | syscall.IN_MOVED_FROM
+
+// Every follower in a directory shares one inotify instance, since each
+// instance counts against fs.inotify.max_user_instances and tailing a
+// directory of logs would otherwise run out. The instance is closed once the
+// last of its watchers is.
+var inotifyDirs = struct {
+	sync.Mutex
+	byPath map[string]*inotifyDir
+}{byPath: map[string]*inotifyDir{}}
+
+// inotifyDir is the inotify instance watching one directory. Its watchers
+// are guarded by inotifyDirs.
+type inotifyDir struct {
+	path     string
+	file     *os.File
+	watchers map[string]map[*inotifyWatcher]struct{} // by file name
+}
+
+// inotifyWatcher receives the events of one file in an inotifyDir.
+type inotifyWatcher struct {
+	dir      *inotifyDir
+	name     string
+	events   chan struct{}
+	replaced atomic.Bool
+	closed   bool // guarded by inotifyDirs
+}
+
+// newNotifier watches filePath for changes with inotify.
+func newNotifier(filePath string) (notifier, error) {
+	inotifyDirs.Lock()
+	defer inotifyDirs.Unlock()
+
+	dirPath := filepath.Dir(filePath)
+	d := inotifyDirs.byPath[dirPath]
+	if d == nil {
+		var err error
+		if d, err = watchDir(dirPath); err != nil {
+			return nil, err
+		}
+		inotifyDirs.byPath[dirPath] = d
+	}
+
+	w := &inotifyWatcher{
+		dir:    d,
+		name:   filepath.Base(filePath),
+		events: make(chan struct{}, 1),
+	}
+	if d.watchers[w.name] == nil {
+		d.watchers[w.name] = map[*inotifyWatcher]struct{}{}
+	}
+	d.watchers[w.name][w] = struct{}{}
+	return w, nil
+}
+
+// watchDir starts an inotify instance on dirPath.
+func watchDir(dirPath string) (*inotifyDir, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, dirPath, inotifyMask); err != nil {
+		syscall.Close(fd)
+		return nil, os.NewSyscallError("inotify_add_watch", err)
+	}
+
+	// A non-blocking descriptor is registered with the runtime poller, so
+	// Read parks the goroutine and Close wakes it up.
+	d := &inotifyDir{
+		path:     dirPath,
+		file:     os.NewFile(uintptr(fd), "inotify"),
+		watchers: map[string]map[*inotifyWatcher]struct{}{},
+	}
+	go d.readLoop()
+	return d, nil
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *inotifyWatcher) Replaced() bool {
+	return w.replaced.Swap(false)
+}
+
+func (w *inotifyWatcher) Close() error {
+	inotifyDirs.Lock()
+	defer inotifyDirs.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	close(w.events)
+
+	d := w.dir
+	delete(d.watchers[w.name], w)
+	if len(d.watchers[w.name]) == 0 {
+		delete(d.watchers, w.name)
+	}
+	if len(d.watchers) > 0 {
+		return nil
+	}
+	d.forget()
+	return d.file.Close()
+}
+
+// signal queues an event unless one is already pending. The caller holds
+// inotifyDirs.
+func (w *inotifyWatcher) signal() {
+	select {
+	case w.events <- struct{}{}:
+	default:
+	}
+}
+
+// forget removes d from inotifyDirs, which the caller holds, so the next
+// notifier for its directory starts a new instance.
+func (d *inotifyDir) forget() {
+	if inotifyDirs.byPath[d.path] == d {
+		delete(inotifyDirs.byPath, d.path)
+	}
+}
+
+// shutdown closes d and the events of every watcher still using it.
+func (d *inotifyDir) shutdown() {
+	inotifyDirs.Lock()
+	defer inotifyDirs.Unlock()
+	d.forget()
+	for _, ws := range d.watchers {
+		for w := range ws {
+			w.closed = true
+			close(w.events)
+		}
+	}
+	d.watchers = map[string]map[*inotifyWatcher]struct{}{}
+	d.file.Close()
+}
+
+func (d *inotifyDir) readLoop() {
+	defer d.shutdown()
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := d.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		// changed maps the names of the files that changed to whether they
+		// left the path.
+		changed := map[string]bool{}
+		all, gone := false, false
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			off = start + nameLen
+			if off > n {
+				break
+			}
+			evName := string(trimNUL(buf[start:off]))
+
+			switch {
+			case mask&syscall.IN_Q_OVERFLOW != 0:
+				// Events were dropped; assume every file changed.
+				all = true
+			case mask&(syscall.IN_DELETE_SELF|syscall.IN_MOVE_SELF|syscall.IN_IGNORED) != 0:
+				// The directory itself went away; the watch is dead.
+				all, gone = true, true
+			case evName != "":
+				changed[evName] = changed[evName] || mask&goneMask != 0
+			}
+		}
+
+		d.dispatch(changed, all)
+		if gone {
+			return
+		}
+	}
+}
+
+// dispatch signals the watchers of the changed files, or all of them.
+func (d *inotifyDir) dispatch(changed map[string]bool, all bool) {
+	inotifyDirs.Lock()
+	defer inotifyDirs.Unlock()
+	for name, ws := range d.watchers {
+		left, ok := changed[name]
+		if !ok && !all {
+			continue
+		}
+		for w := range ws {
+			if left {
+				w.replaced.Store(true)
+			}
+			w.signal()
+		}
+	}
+}
+
+func trimNUL(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+	return b
+}
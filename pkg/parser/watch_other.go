@@ -0,0 +1,10 @@
+//go:build !linux
+
+package parser
+
+import "errors"
+
+// newNotifier is only implemented on Linux; elsewhere tailers poll.
+func newNotifier(filePath string) (notifier, error) {
+	return nil, errors.New("filesystem notifications are not supported on this platform")
+}
@@ -0,0 +1,295 @@
+// Package pipeline provides the worker pool that the tailer and the ingestion
+// API use to process messages concurrently.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrClosed is returned by Submit once the pool has been closed.
+var ErrClosed = errors.New("pipeline closed")
+
+// ErrPanic wraps the value recovered from a handler that panicked. A panic
+// counts as a failed attempt like any returned error.
+var ErrPanic = errors.New("handler panicked")
+
+// Handler processes one item on the given worker. Returning an error marks
+// the attempt as failed, and it is retried if the pool allows more attempts.
+type Handler[T any] func(ctx context.Context, workerID int, item T) error
+
+// Config configures a Pool.
+type Config[T any] struct {
+	// Workers is the number of goroutines running the handler.
+	Workers int
+	// QueueSize is the number of items buffered per queue (default 100).
+	QueueSize int
+	// Key, if set, shards items onto workers by a stable hash of their key,
+	// giving every worker its own queue. Items sharing a key are then
+	// handled one at a time in submission order, while different keys still
+	// run in parallel. Without a Key all workers share one queue.
+	Key func(T) string
+	// MaxAttempts is how many times a failing item is tried (default 1).
+	MaxAttempts int
+	// Backoff is the pause before the first retry; it doubles on each
+	// further retry up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// OnFailure, if set, is called when an item has failed its last attempt.
+	OnFailure func(workerID int, item T, err error, attempts int)
+}
+
+// WorkerStats reports what one worker has done since the pool started.
+type WorkerStats struct {
+	WorkerID  int           `json:"workerId"`
+	Processed uint64        `json:"processed"`
+	Failed    uint64        `json:"failed"`
+	Retries   uint64        `json:"retries"`
+	Busy      time.Duration `json:"busy"`
+	PerSecond float64       `json:"perSecond"`
+}
+
+// Pool runs a handler over submitted items on a fixed set of workers.
+type Pool[T any] struct {
+	cfg     Config[T]
+	handler Handler[T]
+	ctx     context.Context
+	cancel  context.CancelFunc
+	started time.Time
+
+	mu     sync.RWMutex // guards closed against concurrent Submit and Close
+	closed bool
+	queues []chan envelope[T]
+
+	workers sync.WaitGroup
+	stats   []workerCounters
+}
+
+type envelope[T any] struct {
+	item T
+	done func(error)
+}
+
+type workerCounters struct {
+	processed, failed, retries atomic.Uint64
+	busy                       atomic.Int64
+}
+
+// New starts a pool. Handlers receive a context derived from ctx, which is
+// cancelled when ctx is or when Shutdown gives up waiting.
+func New[T any](ctx context.Context, cfg Config[T], handler Handler[T]) *Pool[T] {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.QueueSize < 1 {
+		cfg.QueueSize = 100
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+
+	p := &Pool[T]{
+		cfg:     cfg,
+		handler: handler,
+		started: time.Now(),
+		stats:   make([]workerCounters, cfg.Workers),
+	}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+
+	numQueues := 1
+	if cfg.Key != nil {
+		numQueues = cfg.Workers
+	}
+	p.queues = make([]chan envelope[T], numQueues)
+	for i := range p.queues {
+		p.queues[i] = make(chan envelope[T], cfg.QueueSize)
+	}
+
+	p.workers.Add(cfg.Workers)
+	for i := 0; i < cfg.Workers; i++ {
+		go p.work(i, p.queues[i%numQueues])
+	}
+
+	return p
+}
+
+// Submit queues item, blocking while its queue is full until ctx is done.
+func (p *Pool[T]) Submit(ctx context.Context, item T) error {
+	return p.SubmitFunc(ctx, item, nil)
+}
+
+// SubmitFunc is like Submit but calls done with the final result once the
+// item has been handled, after any retries. done is not called if the item
+// could not be queued.
+func (p *Pool[T]) SubmitFunc(ctx context.Context, item T, done func(error)) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+
+	queue := p.queues[p.shard(item)]
+	select {
+	case queue <- envelope[T]{item: item, done: done}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.ctx.Done():
+		return p.ctx.Err()
+	}
+}
+
+// Close stops accepting new items. Items already queued are still handled;
+// use Wait to block until they have been.
+func (p *Pool[T]) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for _, q := range p.queues {
+		close(q)
+	}
+}
+
+// Wait blocks until the pool has been closed and every queued item handled.
+func (p *Pool[T]) Wait() {
+	p.workers.Wait()
+	p.cancel()
+}
+
+// Shutdown closes the pool and waits for queued items to drain. If ctx ends
+// first, handlers are cancelled, remaining items are abandoned with the
+// context's error, and that error is returned once the workers have exited.
+func (p *Pool[T]) Shutdown(ctx context.Context) error {
+	p.Close()
+
+	drained := make(chan struct{})
+	go func() {
+		p.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-drained
+		return ctx.Err()
+	}
+}
+
+// Queued returns the number of items waiting for a worker.
+func (p *Pool[T]) Queued() int {
+	n := 0
+	for _, q := range p.queues {
+		n += len(q)
+	}
+	return n
+}
+
+// Capacity returns the total number of items the queues can buffer.
+func (p *Pool[T]) Capacity() int {
+	return len(p.queues) * p.cfg.QueueSize
+}
+
+// Stats returns a snapshot of every worker's counters.
+func (p *Pool[T]) Stats() []WorkerStats {
+	elapsed := time.Since(p.started).Seconds()
+	out := make([]WorkerStats, len(p.stats))
+	for i := range p.stats {
+		c := &p.stats[i]
+		out[i] = WorkerStats{
+			WorkerID:  i,
+			Processed: c.processed.Load(),
+			Failed:    c.failed.Load(),
+			Retries:   c.retries.Load(),
+			Busy:      time.Duration(c.busy.Load()),
+		}
+		if elapsed > 0 {
+			out[i].PerSecond = float64(out[i].Processed) / elapsed
+		}
+	}
+	return out
+}
+
+func (p *Pool[T]) work(workerID int, queue <-chan envelope[T]) {
+	defer p.workers.Done()
+	for env := range queue {
+		// After Shutdown gives up, drain without handling.
+		if err := p.ctx.Err(); err != nil {
+			p.finish(workerID, env, err, 0)
+			continue
+		}
+
+		start := time.Now()
+		attempts, err := p.attempt(workerID, env.item)
+		p.stats[workerID].busy.Add(int64(time.Since(start)))
+		p.finish(workerID, env, err, attempts)
+	}
+}
+
+// attempt runs the handler until it succeeds or runs out of attempts.
+func (p *Pool[T]) attempt(workerID int, item T) (int, error) {
+	backoff := p.cfg.Backoff
+	for attempt := 1; ; attempt++ {
+		err := p.call(workerID, item)
+		if err == nil || attempt >= p.cfg.MaxAttempts {
+			return attempt, err
+		}
+
+		p.stats[workerID].retries.Add(1)
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return attempt, err
+		}
+		backoff *= 2
+		if p.cfg.MaxBackoff > 0 && backoff > p.cfg.MaxBackoff {
+			backoff = p.cfg.MaxBackoff
+		}
+	}
+}
+
+// call runs the handler once, turning a panic into an error so one bad item
+// cannot take down the process.
+func (p *Pool[T]) call(workerID int, item T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrPanic, r)
+		}
+	}()
+	return p.handler(p.ctx, workerID, item)
+}
+
+func (p *Pool[T]) finish(workerID int, env envelope[T], err error, attempts int) {
+	if err == nil {
+		p.stats[workerID].processed.Add(1)
+	} else {
+		p.stats[workerID].failed.Add(1)
+		if p.cfg.OnFailure != nil && attempts > 0 {
+			p.cfg.OnFailure(workerID, env.item, err, attempts)
+		}
+	}
+	if env.done != nil {
+		env.done(err)
+	}
+}
+
+// shard picks the queue for an item. The hash is stable, so a key keeps its
+// worker for the lifetime of the pool.
+func (p *Pool[T]) shard(item T) int {
+	if len(p.queues) == 1 {
+		return 0
+	}
+	h := fnv.New32a()
+	h.Write([]byte(p.cfg.Key(item)))
+	return int(h.Sum32() % uint32(len(p.queues)))
+}
@@ -0,0 +1,194 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/pipeline"
+)
+
+type item struct {
+	key string
+	n   int
+}
+
+var _ = Describe("Worker Pool", func() {
+	It("keeps each key in order and on one worker when keyed", func() {
+		var (
+			mu      sync.Mutex
+			order   = map[string][]int{}
+			workers = map[string]map[int]bool{}
+		)
+		handler := func(_ context.Context, workerID int, it item) error {
+			// Jitter so an unkeyed pool would visibly interleave.
+			time.Sleep(time.Duration(rand.Intn(300)) * time.Microsecond)
+			mu.Lock()
+			defer mu.Unlock()
+			order[it.key] = append(order[it.key], it.n)
+			if workers[it.key] == nil {
+				workers[it.key] = map[int]bool{}
+			}
+			workers[it.key][workerID] = true
+			return nil
+		}
+
+		cfg := pipeline.Config[item]{Workers: 4, Key: func(it item) string { return it.key }}
+		pool := pipeline.New(context.Background(), cfg, handler)
+		const keys, perKey = 6, 40
+		for n := 0; n < perKey; n++ {
+			for k := 0; k < keys; k++ {
+				Expect(pool.Submit(context.Background(), item{key: fmt.Sprintf("k%d", k), n: n})).To(Succeed())
+			}
+		}
+		Expect(pool.Shutdown(context.Background())).To(Succeed())
+
+		for k := 0; k < keys; k++ {
+			key := fmt.Sprintf("k%d", k)
+			Expect(order[key]).To(HaveLen(perKey))
+			for i, n := range order[key] {
+				Expect(n).To(Equal(i), "key %s out of order", key)
+			}
+			Expect(workers[key]).To(HaveLen(1))
+		}
+	})
+
+	It("uses every worker without a key", func() {
+		var (
+			mu   sync.Mutex
+			seen = map[int]bool{}
+		)
+		pool := pipeline.New(context.Background(), pipeline.Config[item]{Workers: 3},
+			func(_ context.Context, workerID int, it item) error {
+				time.Sleep(2 * time.Millisecond)
+				mu.Lock()
+				defer mu.Unlock()
+				seen[workerID] = true
+				return nil
+			})
+		for i := 0; i < 30; i++ {
+			Expect(pool.Submit(context.Background(), item{key: "same", n: i})).To(Succeed())
+		}
+		Expect(pool.Shutdown(context.Background())).To(Succeed())
+
+		Expect(seen).To(HaveLen(3))
+	})
+
+	It("retries failing items with backoff and reports the final failure", func() {
+		var (
+			calls    atomic.Int32
+			mu       sync.Mutex
+			failures []int
+		)
+		cfg := pipeline.Config[item]{
+			Workers:     1,
+			MaxAttempts: 3,
+			Backoff:     time.Millisecond,
+			OnFailure: func(workerID int, it item, err error, attempts int) {
+				mu.Lock()
+				defer mu.Unlock()
+				failures = append(failures, attempts)
+			},
+		}
+		pool := pipeline.New(context.Background(), cfg, func(_ context.Context, _ int, it item) error {
+			calls.Add(1)
+			if it.n == 0 || calls.Load() < 2 {
+				return errors.New("boom")
+			}
+			return nil
+		})
+
+		results := make(chan error, 2)
+		done := func(err error) { results <- err }
+		Expect(pool.SubmitFunc(context.Background(), item{n: 1}, done)).To(Succeed())
+		Expect(pool.SubmitFunc(context.Background(), item{n: 0}, done)).To(Succeed())
+		Expect(pool.Shutdown(context.Background())).To(Succeed())
+
+		Expect(<-results).To(Succeed())
+		Expect(<-results).To(MatchError("boom"))
+		Expect(failures).To(Equal([]int{3}))
+
+		stats := pool.Stats()
+		Expect(stats).To(HaveLen(1))
+		Expect(stats[0].Processed).To(BeEquivalentTo(1))
+		Expect(stats[0].Failed).To(BeEquivalentTo(1))
+		Expect(stats[0].Retries).To(BeEquivalentTo(3))
+	})
+
+	It("recovers a panicking handler and keeps the worker running", func() {
+		var failed error
+		cfg := pipeline.Config[item]{
+			Workers: 1,
+			OnFailure: func(_ int, _ item, err error, _ int) {
+				failed = err
+			},
+		}
+		var handled atomic.Int32
+		pool := pipeline.New(context.Background(), cfg, func(_ context.Context, _ int, it item) error {
+			if it.n == 0 {
+				panic("bad item")
+			}
+			handled.Add(1)
+			return nil
+		})
+		Expect(pool.Submit(context.Background(), item{n: 0})).To(Succeed())
+		Expect(pool.Submit(context.Background(), item{n: 1})).To(Succeed())
+		Expect(pool.Shutdown(context.Background())).To(Succeed())
+
+		Expect(failed).To(MatchError(pipeline.ErrPanic))
+		Expect(failed).To(MatchError(ContainSubstring("bad item")))
+		Expect(handled.Load()).To(BeEquivalentTo(1))
+	})
+
+	It("drains queued work on Shutdown and refuses new items", func() {
+		var handled atomic.Int32
+		pool := pipeline.New(context.Background(), pipeline.Config[item]{Workers: 2},
+			func(_ context.Context, _ int, _ item) error {
+				time.Sleep(time.Millisecond)
+				handled.Add(1)
+				return nil
+			})
+		for i := 0; i < 20; i++ {
+			Expect(pool.Submit(context.Background(), item{n: i})).To(Succeed())
+		}
+		Expect(pool.Shutdown(context.Background())).To(Succeed())
+
+		Expect(handled.Load()).To(BeEquivalentTo(20))
+		Expect(pool.Queued()).To(BeZero())
+		Expect(pool.Submit(context.Background(), item{})).To(MatchError(pipeline.ErrClosed))
+	})
+
+	It("cancels handlers and abandons the queue when Shutdown times out", func() {
+		release := make(chan struct{})
+		var abandoned atomic.Int32
+		pool := pipeline.New(context.Background(), pipeline.Config[item]{Workers: 1},
+			func(ctx context.Context, _ int, _ item) error {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-release:
+					return nil
+				}
+			})
+		defer close(release)
+		for i := 0; i < 5; i++ {
+			Expect(pool.SubmitFunc(context.Background(), item{n: i}, func(err error) {
+				if errors.Is(err, context.Canceled) {
+					abandoned.Add(1)
+				}
+			})).To(Succeed())
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		Expect(pool.Shutdown(ctx)).To(MatchError(context.DeadlineExceeded))
+		Expect(abandoned.Load()).To(BeEquivalentTo(5))
+	})
+})
@@ -0,0 +1,46 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"go.etcd.io/bbolt"
+)
+
+// BoltStorage implements parser.CheckpointStore, keeping one checkpoint per
+// log path in CheckpointBucket.
+var _ parser.CheckpointStore = (*BoltStorage)(nil)
+
+// LoadCheckpoint returns the tailer checkpoint saved for path, or nil if
+// there is none.
+func (s *BoltStorage) LoadCheckpoint(path string) (*parser.Checkpoint, error) {
+	var cp *parser.Checkpoint
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(CheckpointBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", CheckpointBucket)
+		}
+		v := b.Get([]byte(path))
+		if v == nil {
+			return nil
+		}
+		cp = &parser.Checkpoint{}
+		return json.Unmarshal(v, cp)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// SaveCheckpoint stores a tailer checkpoint under its path.
+func (s *BoltStorage) SaveCheckpoint(cp parser.Checkpoint) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(CheckpointBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", CheckpointBucket)
+		}
+		return putJSON(b, cp.Path, cp)
+	})
+}
@@ -0,0 +1,616 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	// ErrNotFound is returned when updating or deleting a record that does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrExists is returned when creating a record whose id is already taken.
+	ErrExists = errors.New("already exists")
+	// ErrMissingEndpoint is returned when an edge names a concept that does
+	// not exist. It wraps ErrNotFound.
+	ErrMissingEndpoint = fmt.Errorf("edge endpoint %w", ErrNotFound)
+	// ErrNoLabel is returned when storing a concept without a label.
+	ErrNoLabel = errors.New("concept has no label")
+	// ErrInvalidID is returned when creating a concept or edge whose id
+	// contains NUL, which separates the index keys, or '/', which would
+	// make it unreachable by URL.
+	ErrInvalidID = errors.New("invalid id")
+)
+
+// Concepts are stored flat in ConceptBucket keyed by id. Edges keep their
+// records plus two adjacency indices inside EdgeBucket:
+//
+//	Edges/records/<edgeID>          -> JSON Edge
+//	Edges/out/<fromID> 0x00 <edgeID> -> nil
+//	Edges/in/<toID> 0x00 <edgeID>    -> nil
+//
+// so the edges touching a concept are a prefix scan rather than a full scan.
+var (
+	edgeRecordsBucket = []byte("records")
+	edgeOutBucket     = []byte("out")
+	edgeInBucket      = []byte("in")
+)
+
+// MessageRef points at a stored chat message.
+type MessageRef struct {
+	SessionID string `json:"sessionId"`
+	MessageID int    `json:"messageId"`
+}
+
+// Provenance records who or what introduced a concept.
+type Provenance struct {
+	User   string `json:"user,omitempty"`
+	Source string `json:"source,omitempty"`
+}
+
+// Concept is a node of the mind-map.
+type Concept struct {
+	ID         string      `json:"id"`
+	Label      string      `json:"label"`
+	Kind       string      `json:"kind,omitempty"`
+	Aliases    []string    `json:"aliases,omitempty"`
+	Provenance Provenance  `json:"provenance"`
+	FirstSeen  *MessageRef `json:"firstSeen,omitempty"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	UpdatedAt  time.Time   `json:"updatedAt"`
+}
+
+// Edge is a directed, typed relationship between two concepts.
+type Edge struct {
+	ID        string       `json:"id"`
+	From      string       `json:"from"`
+	To        string       `json:"to"`
+	Relation  string       `json:"relation"`
+	Weight    float64      `json:"weight"`
+	Evidence  []MessageRef `json:"evidence,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+}
+
+// CreateConcept stores a new concept. An id is generated if c.ID is empty;
+// either way the stored id and timestamps are written back into c.
+func (s *BoltStorage) CreateConcept(c *Concept) error {
+	if c.Label == "" {
+		return ErrNoLabel
+	}
+	if c.ID == "" {
+		c.ID = newID()
+	}
+	if err := validateID(c.ID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	c.CreatedAt, c.UpdatedAt = now, now
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := conceptBucket(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(c.ID)) != nil {
+			return fmt.Errorf("concept %s: %w", c.ID, ErrExists)
+		}
+		return putJSON(b, c.ID, c)
+	})
+}
+
+// GetConcept retrieves a concept by id. It returns nil without an error if the
+// concept does not exist.
+func (s *BoltStorage) GetConcept(id string) (*Concept, error) {
+	var c *Concept
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		c, err = getConcept(s.root(tx), id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// UpdateConcept replaces an existing concept, keeping its creation time.
+func (s *BoltStorage) UpdateConcept(c *Concept) error {
+	if c.Label == "" {
+		return ErrNoLabel
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := conceptBucket(s.root(tx))
+		if err != nil {
+			return err
+		}
+		prev, err := getConcept(s.root(tx), c.ID)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return fmt.Errorf("concept %s: %w", c.ID, ErrNotFound)
+		}
+		c.CreatedAt = prev.CreatedAt
+		c.UpdatedAt = time.Now().UTC()
+		return putJSON(b, c.ID, c)
+	})
+}
+
+// RenameConcept gives a concept a new label, keeping the old one among its
+// aliases and dropping the new one from them, and returns the updated
+// concept. The read and the write are one transaction, so concurrent renames
+// do not lose each other's aliases.
+func (s *BoltStorage) RenameConcept(id, label string) (*Concept, error) {
+	if label == "" {
+		return nil, ErrNoLabel
+	}
+	var c *Concept
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := conceptBucket(s.root(tx))
+		if err != nil {
+			return err
+		}
+		c, err = getConcept(s.root(tx), id)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("concept %s: %w", id, ErrNotFound)
+		}
+		if c.Label != label {
+			if !slices.Contains(c.Aliases, c.Label) {
+				c.Aliases = append(c.Aliases, c.Label)
+			}
+			c.Aliases = slices.DeleteFunc(c.Aliases, func(a string) bool { return a == label })
+			c.Label = label
+		}
+		c.UpdatedAt = time.Now().UTC()
+		return putJSON(b, c.ID, c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DeleteConcept removes a concept together with every edge that touches it.
+func (s *BoltStorage) DeleteConcept(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b, err := conceptBucket(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if b.Get([]byte(id)) == nil {
+			return fmt.Errorf("concept %s: %w", id, ErrNotFound)
+		}
+
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		ids := append(adjacentEdgeIDs(eb.out, id), adjacentEdgeIDs(eb.in, id)...)
+		for _, edgeID := range ids {
+			if err := eb.delete(edgeID); err != nil {
+				return err
+			}
+		}
+		return b.Delete([]byte(id))
+	})
+}
+
+// ListConcepts returns every concept ordered by id.
+func (s *BoltStorage) ListConcepts() ([]Concept, error) {
+	var out []Concept
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b, err := conceptBucket(s.root(tx))
+		if err != nil {
+			return err
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var c Concept
+			if err := json.Unmarshal(v, &c); err != nil {
+				return err
+			}
+			out = append(out, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListConceptsAfter returns up to limit concepts whose id sorts after the
+// given one, ordered by id. Pass "" to start from the first concept; a limit
+// of zero or less means no limit.
+func (s *BoltStorage) ListConceptsAfter(after string, limit int) ([]Concept, error) {
+	var out []Concept
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b, err := conceptBucket(s.root(tx))
+		if err != nil {
+			return err
+		}
+		return scanAfter(b, []byte(after), limit, func(_, v []byte) (bool, error) {
+			var c Concept
+			if err := json.Unmarshal(v, &c); err != nil {
+				return false, err
+			}
+			out = append(out, c)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateEdge stores a new edge between two existing concepts. An id is
+// generated if e.ID is empty.
+func (s *BoltStorage) CreateEdge(e *Edge) error {
+	if e.Relation == "" {
+		return errors.New("edge has no relation")
+	}
+	if e.ID == "" {
+		e.ID = newID()
+	}
+	if err := validateID(e.ID); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	e.CreatedAt, e.UpdatedAt = now, now
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := requireEndpoints(s.root(tx), e); err != nil {
+			return err
+		}
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if eb.records.Get([]byte(e.ID)) != nil {
+			return fmt.Errorf("edge %s: %w", e.ID, ErrExists)
+		}
+		return eb.put(e)
+	})
+}
+
+// GetEdge retrieves an edge by id. It returns nil without an error if the edge
+// does not exist.
+func (s *BoltStorage) GetEdge(id string) (*Edge, error) {
+	var e *Edge
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		e, err = eb.get(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// UpdateEdge replaces an existing edge, re-indexing it if its endpoints moved.
+func (s *BoltStorage) UpdateEdge(e *Edge) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if err := requireEndpoints(s.root(tx), e); err != nil {
+			return err
+		}
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		prev, err := eb.get(e.ID)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return fmt.Errorf("edge %s: %w", e.ID, ErrNotFound)
+		}
+		if err := eb.delete(e.ID); err != nil {
+			return err
+		}
+		e.CreatedAt = prev.CreatedAt
+		e.UpdatedAt = time.Now().UTC()
+		return eb.put(e)
+	})
+}
+
+// DeleteEdge removes an edge and its index entries.
+func (s *BoltStorage) DeleteEdge(id string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if eb.records.Get([]byte(id)) == nil {
+			return fmt.Errorf("edge %s: %w", id, ErrNotFound)
+		}
+		return eb.delete(id)
+	})
+}
+
+// ListEdges returns every edge ordered by id.
+func (s *BoltStorage) ListEdges() ([]Edge, error) {
+	var out []Edge
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if eb.records == nil {
+			return nil
+		}
+		return eb.records.ForEach(func(_, v []byte) error {
+			var e Edge
+			if err := json.Unmarshal(v, &e); err != nil {
+				return err
+			}
+			out = append(out, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListEdgesAfter returns up to limit edges whose id sorts after the given
+// one, ordered by id. Pass "" to start from the first edge; a limit of zero or
+// less means no limit.
+func (s *BoltStorage) ListEdgesAfter(after string, limit int) ([]Edge, error) {
+	var out []Edge
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if eb.records == nil {
+			return nil
+		}
+		return scanAfter(eb.records, []byte(after), limit, func(_, v []byte) (bool, error) {
+			var e Edge
+			if err := json.Unmarshal(v, &e); err != nil {
+				return false, err
+			}
+			out = append(out, e)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// OutgoingEdges returns the edges whose From is conceptID.
+func (s *BoltStorage) OutgoingEdges(conceptID string) ([]Edge, error) {
+	return s.adjacentEdges(conceptID, true)
+}
+
+// IncomingEdges returns the edges whose To is conceptID.
+func (s *BoltStorage) IncomingEdges(conceptID string) ([]Edge, error) {
+	return s.adjacentEdges(conceptID, false)
+}
+
+func (s *BoltStorage) adjacentEdges(conceptID string, outgoing bool) ([]Edge, error) {
+	var out []Edge
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		eb, err := edgeBuckets(s.root(tx))
+		if err != nil {
+			return err
+		}
+		index := eb.in
+		if outgoing {
+			index = eb.out
+		}
+		for _, id := range adjacentEdgeIDs(index, conceptID) {
+			e, err := eb.get(id)
+			if err != nil {
+				return err
+			}
+			if e != nil {
+				out = append(out, *e)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func conceptBucket(parent bucketParent) (*bbolt.Bucket, error) {
+	b := parent.Bucket([]byte(ConceptBucket))
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s not found", ConceptBucket)
+	}
+	return b, nil
+}
+
+func getConcept(parent bucketParent, id string) (*Concept, error) {
+	b, err := conceptBucket(parent)
+	if err != nil {
+		return nil, err
+	}
+	v := b.Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	c := &Concept{}
+	if err := json.Unmarshal(v, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func requireEndpoints(parent bucketParent, e *Edge) error {
+	for _, id := range []string{e.From, e.To} {
+		c, err := getConcept(parent, id)
+		if err != nil {
+			return err
+		}
+		if c == nil {
+			return fmt.Errorf("concept %q: %w", id, ErrMissingEndpoint)
+		}
+	}
+	return nil
+}
+
+// edgeIndex bundles the record bucket and adjacency indices of EdgeBucket.
+// The sub-buckets are created on first write, so in a read-only transaction
+// they are nil until an edge has been stored; the helpers treat that as empty.
+type edgeIndex struct {
+	records, out, in *bbolt.Bucket
+}
+
+func edgeBuckets(parent bucketParent) (*edgeIndex, error) {
+	b := parent.Bucket([]byte(EdgeBucket))
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s not found", EdgeBucket)
+	}
+	if !b.Tx().Writable() {
+		if b.Bucket(edgeRecordsBucket) == nil {
+			return &edgeIndex{}, nil
+		}
+		return &edgeIndex{
+			records: b.Bucket(edgeRecordsBucket),
+			out:     b.Bucket(edgeOutBucket),
+			in:      b.Bucket(edgeInBucket),
+		}, nil
+	}
+
+	eb := &edgeIndex{}
+	var err error
+	if eb.records, err = b.CreateBucketIfNotExists(edgeRecordsBucket); err != nil {
+		return nil, err
+	}
+	if eb.out, err = b.CreateBucketIfNotExists(edgeOutBucket); err != nil {
+		return nil, err
+	}
+	if eb.in, err = b.CreateBucketIfNotExists(edgeInBucket); err != nil {
+		return nil, err
+	}
+	return eb, nil
+}
+
+func (eb *edgeIndex) get(id string) (*Edge, error) {
+	if eb.records == nil {
+		return nil, nil
+	}
+	v := eb.records.Get([]byte(id))
+	if v == nil {
+		return nil, nil
+	}
+	e := &Edge{}
+	if err := json.Unmarshal(v, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (eb *edgeIndex) put(e *Edge) error {
+	if err := putJSON(eb.records, e.ID, e); err != nil {
+		return err
+	}
+	if err := eb.out.Put(adjacencyKey(e.From, e.ID), nil); err != nil {
+		return err
+	}
+	return eb.in.Put(adjacencyKey(e.To, e.ID), nil)
+}
+
+func (eb *edgeIndex) delete(id string) error {
+	e, err := eb.get(id)
+	if err != nil || e == nil {
+		return err
+	}
+	if err := eb.out.Delete(adjacencyKey(e.From, e.ID)); err != nil {
+		return err
+	}
+	if err := eb.in.Delete(adjacencyKey(e.To, e.ID)); err != nil {
+		return err
+	}
+	return eb.records.Delete([]byte(id))
+}
+
+// adjacentEdgeIDs lists the edge ids indexed under conceptID.
+func adjacentEdgeIDs(index *bbolt.Bucket, conceptID string) []string {
+	if index == nil {
+		return nil
+	}
+	prefix := adjacencyKey(conceptID, "")
+	var ids []string
+	c := index.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		ids = append(ids, string(k[len(prefix):]))
+	}
+	return ids
+}
+
+func adjacencyKey(conceptID, edgeID string) []byte {
+	return []byte(conceptID + "\x00" + edgeID)
+}
+
+// scanAfter calls fn for the entries of b whose key sorts after the given
+// one, or for every entry if after is empty, until fn has included limit of
+// them. fn reports whether it included the entry; a limit of zero or less
+// means no limit.
+func scanAfter(b *bbolt.Bucket, after []byte, limit int, fn func(k, v []byte) (bool, error)) error {
+	c := b.Cursor()
+	k, v := c.First()
+	if len(after) > 0 {
+		k, v = c.Seek(after)
+		if k != nil && bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+	}
+	for n := 0; k != nil && (limit <= 0 || n < limit); k, v = c.Next() {
+		included, err := fn(k, v)
+		if err != nil {
+			return err
+		}
+		if included {
+			n++
+		}
+	}
+	return nil
+}
+
+func putJSON(b *bbolt.Bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", key, err)
+	}
+	return b.Put([]byte(key), data)
+}
+
+func validateID(id string) error {
+	if strings.ContainsRune(id, 0) {
+		return fmt.Errorf("%w %q: contains NUL", ErrInvalidID, id)
+	}
+	if strings.ContainsRune(id, '/') {
+		return fmt.Errorf("%w %q: contains '/'", ErrInvalidID, id)
+	}
+	return nil
+}
+
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
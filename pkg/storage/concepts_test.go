@@ -0,0 +1,299 @@
+package storage_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Concept Graph Model", func() {
+	var dbStore *storage.BoltStorage
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "graph.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	concept := func(id, label string) *storage.Concept {
+		c := &storage.Concept{ID: id, Label: label, Kind: "topic"}
+		Expect(dbStore.CreateConcept(c)).To(Succeed())
+		return c
+	}
+
+	It("creates, reads, updates and deletes concepts", func() {
+		c := &storage.Concept{
+			Label:      "graph databases",
+			Kind:       "topic",
+			Aliases:    []string{"graph db"},
+			Provenance: storage.Provenance{User: "brett"},
+			FirstSeen:  &storage.MessageRef{SessionID: "s1", MessageID: 3},
+		}
+		Expect(dbStore.CreateConcept(c)).To(Succeed())
+		Expect(c.ID).NotTo(BeEmpty())
+		Expect(c.CreatedAt).NotTo(BeZero())
+
+		got, err := dbStore.GetConcept(c.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Label).To(Equal("graph databases"))
+		Expect(got.FirstSeen.MessageID).To(Equal(3))
+
+		got.Label = "graph DBs"
+		Expect(dbStore.UpdateConcept(got)).To(Succeed())
+		updated, err := dbStore.GetConcept(c.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(updated.Label).To(Equal("graph DBs"))
+		Expect(updated.CreatedAt.Equal(c.CreatedAt)).To(BeTrue())
+
+		Expect(dbStore.DeleteConcept(c.ID)).To(Succeed())
+		gone, err := dbStore.GetConcept(c.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gone).To(BeNil())
+	})
+
+	It("reports duplicates and missing records with sentinel errors", func() {
+		concept("a", "A")
+		Expect(dbStore.CreateConcept(&storage.Concept{ID: "a", Label: "again"})).To(MatchError(storage.ErrExists))
+		Expect(dbStore.UpdateConcept(&storage.Concept{ID: "zz", Label: "Z"})).To(MatchError(storage.ErrNotFound))
+		Expect(dbStore.DeleteEdge("nope")).To(MatchError(storage.ErrNotFound))
+	})
+
+	It("renames a concept, keeping its old label as an alias", func() {
+		c := concept("a", "graph db")
+		c.Aliases = []string{"graph database"}
+		Expect(dbStore.UpdateConcept(c)).To(Succeed())
+
+		renamed, err := dbStore.RenameConcept("a", "graph database")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(renamed.Label).To(Equal("graph database"))
+		Expect(renamed.Aliases).To(Equal([]string{"graph db"}))
+
+		got, err := dbStore.GetConcept("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Label).To(Equal("graph database"))
+		Expect(got.Aliases).To(Equal([]string{"graph db"}))
+		Expect(got.CreatedAt.Equal(c.CreatedAt)).To(BeTrue())
+
+		_, err = dbStore.RenameConcept("zz", "Z")
+		Expect(err).To(MatchError(storage.ErrNotFound))
+		_, err = dbStore.RenameConcept("a", "")
+		Expect(err).To(MatchError(storage.ErrNoLabel))
+	})
+
+	It("keeps every alias when concepts are renamed concurrently", func() {
+		concept("a", "label-0")
+		var wg sync.WaitGroup
+		for i := 1; i <= 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer GinkgoRecover()
+				_, err := dbStore.RenameConcept("a", fmt.Sprintf("label-%d", i))
+				Expect(err).NotTo(HaveOccurred())
+			}()
+		}
+		wg.Wait()
+
+		got, err := dbStore.GetConcept("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Aliases).To(HaveLen(8))
+		Expect(append(got.Aliases, got.Label)).To(ConsistOf(
+			"label-0", "label-1", "label-2", "label-3", "label-4", "label-5", "label-6", "label-7", "label-8"))
+	})
+
+	It("refuses ids that cannot be keyed or addressed", func() {
+		Expect(dbStore.CreateConcept(&storage.Concept{ID: "a\x00b", Label: "A"})).To(MatchError(storage.ErrInvalidID))
+		Expect(dbStore.CreateConcept(&storage.Concept{ID: "a/b", Label: "A"})).To(MatchError(storage.ErrInvalidID))
+		concept("a", "A")
+		Expect(dbStore.CreateEdge(&storage.Edge{ID: "e/1", From: "a", To: "a", Relation: "rel"})).To(MatchError(storage.ErrInvalidID))
+	})
+
+	It("refuses to store a concept without a label", func() {
+		Expect(dbStore.CreateConcept(&storage.Concept{ID: "a"})).To(MatchError(storage.ErrNoLabel))
+		concept("a", "A")
+		Expect(dbStore.UpdateConcept(&storage.Concept{ID: "a", Kind: "topic"})).To(MatchError(storage.ErrNoLabel))
+
+		got, err := dbStore.GetConcept("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Label).To(Equal("A"))
+	})
+
+	It("refuses edges whose endpoints do not exist", func() {
+		concept("a", "A")
+		err := dbStore.CreateEdge(&storage.Edge{From: "a", To: "ghost", Relation: "relates"})
+		Expect(err).To(MatchError(storage.ErrNotFound))
+	})
+
+	It("lists outgoing and incoming edges through the adjacency indices", func() {
+		concept("a", "A")
+		concept("b", "B")
+		concept("c", "C")
+
+		ab := &storage.Edge{From: "a", To: "b", Relation: "supports", Weight: 0.5,
+			Evidence: []storage.MessageRef{{SessionID: "s1", MessageID: 1}}}
+		ac := &storage.Edge{From: "a", To: "c", Relation: "contradicts", Weight: 1}
+		cb := &storage.Edge{From: "c", To: "b", Relation: "supports", Weight: 2}
+		for _, e := range []*storage.Edge{ab, ac, cb} {
+			Expect(dbStore.CreateEdge(e)).To(Succeed())
+		}
+
+		out, err := dbStore.OutgoingEdges("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(out)).To(ConsistOf(ab.ID, ac.ID))
+
+		in, err := dbStore.IncomingEdges("b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(in)).To(ConsistOf(ab.ID, cb.ID))
+
+		// Re-pointing an edge moves its index entries.
+		ab.To = "c"
+		Expect(dbStore.UpdateEdge(ab)).To(Succeed())
+		in, err = dbStore.IncomingEdges("b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(in)).To(ConsistOf(cb.ID))
+		in, err = dbStore.IncomingEdges("c")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(in)).To(ConsistOf(ab.ID, ac.ID))
+	})
+
+	It("cascades concept deletion to the edges that touch it", func() {
+		concept("a", "A")
+		concept("b", "B")
+		e := &storage.Edge{From: "a", To: "b", Relation: "supports"}
+		Expect(dbStore.CreateEdge(e)).To(Succeed())
+
+		Expect(dbStore.DeleteConcept("b")).To(Succeed())
+
+		got, err := dbStore.GetEdge(e.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).To(BeNil())
+
+		out, err := dbStore.OutgoingEdges("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(BeEmpty())
+	})
+
+	It("merges one concept into another, moving and folding its edges", func() {
+		concept("a", "graph db")
+		b := concept("b", "graph database")
+		b.Aliases = []string{"GDB"}
+		Expect(dbStore.UpdateConcept(b)).To(Succeed())
+		concept("c", "Neo4j")
+
+		ab := &storage.Edge{ID: "ab", From: "a", To: "b", Relation: "same-as"}
+		ac := &storage.Edge{ID: "ac", From: "c", To: "a", Relation: "is-a", Weight: 1,
+			Evidence: []storage.MessageRef{{SessionID: "s", MessageID: 1}}}
+		bc := &storage.Edge{ID: "bc", From: "c", To: "b", Relation: "is-a", Weight: 3,
+			Evidence: []storage.MessageRef{{SessionID: "s", MessageID: 2}}}
+		bb := &storage.Edge{ID: "bb", From: "b", To: "b", Relation: "refines"}
+		for _, e := range []*storage.Edge{ab, ac, bc, bb} {
+			Expect(dbStore.CreateEdge(e)).To(Succeed())
+		}
+
+		result, err := dbStore.MergeConcepts("a", "b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Removed).To(Equal("b"))
+		Expect(result.Concept.Aliases).To(Equal([]string{"graph database", "GDB"}))
+		Expect(result.Deleted).To(ConsistOf("ab", "bc"))
+
+		gone, err := dbStore.GetConcept("b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(gone).To(BeNil())
+
+		folded, err := dbStore.GetEdge("ac")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(folded.Weight).To(Equal(3.0))
+		Expect(folded.Evidence).To(HaveLen(2))
+
+		loop, err := dbStore.GetEdge("bb")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loop.From).To(Equal("a"))
+		Expect(loop.To).To(Equal("a"))
+
+		in, err := dbStore.IncomingEdges("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(in)).To(ConsistOf("ac", "bb"))
+
+		_, err = dbStore.MergeConcepts("a", "a")
+		Expect(err).To(MatchError(storage.ErrSelfMerge))
+		_, err = dbStore.MergeConcepts("a", "zz")
+		Expect(err).To(MatchError(storage.ErrNotFound))
+	})
+
+	It("reports each folded edge once, without repeating its evidence", func() {
+		concept("a", "graph db")
+		concept("b", "graph database")
+		concept("c", "Neo4j")
+
+		m1 := storage.MessageRef{SessionID: "s", MessageID: 1}
+		m2 := storage.MessageRef{SessionID: "s", MessageID: 2}
+		for _, e := range []*storage.Edge{
+			{ID: "ca", From: "c", To: "a", Relation: "is-a", Evidence: []storage.MessageRef{m1}},
+			{ID: "cb1", From: "c", To: "b", Relation: "is-a", Evidence: []storage.MessageRef{m1, m2}},
+			{ID: "cb2", From: "c", To: "b", Relation: "is-a", Weight: 2, Evidence: []storage.MessageRef{m2}},
+		} {
+			Expect(dbStore.CreateEdge(e)).To(Succeed())
+		}
+
+		result, err := dbStore.MergeConcepts("a", "b")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Deleted).To(ConsistOf("cb1", "cb2"))
+		Expect(result.Updated).To(HaveLen(1))
+		Expect(result.Updated[0].ID).To(Equal("ca"))
+		Expect(result.Updated[0].Weight).To(Equal(2.0))
+		Expect(result.Updated[0].Evidence).To(Equal([]storage.MessageRef{m1, m2}))
+
+		stored, err := dbStore.GetEdge("ca")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(stored.Evidence).To(Equal(result.Updated[0].Evidence))
+	})
+
+	It("pages through concepts and edges by id", func() {
+		for _, id := range []string{"c", "a", "d", "b"} {
+			concept(id, id)
+		}
+		for _, id := range []string{"e2", "e1", "e3"} {
+			Expect(dbStore.CreateEdge(&storage.Edge{ID: id, From: "a", To: "b", Relation: "rel"})).To(Succeed())
+		}
+
+		concepts, err := dbStore.ListConceptsAfter("", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(concepts).To(HaveLen(2))
+		Expect(concepts[1].ID).To(Equal("b"))
+		concepts, err = dbStore.ListConceptsAfter("b", 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(concepts[0].ID).To(Equal("c"))
+		Expect(concepts[1].ID).To(Equal("d"))
+
+		edges, err := dbStore.ListEdgesAfter("e1", 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(edges)).To(Equal([]string{"e2", "e3"}))
+	})
+
+	It("lists nothing on a fresh database", func() {
+		edges, err := dbStore.ListEdges()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edges).To(BeEmpty())
+
+		concepts, err := dbStore.ListConcepts()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(concepts).To(BeEmpty())
+	})
+})
+
+func edgeIDs(edges []storage.Edge) []string {
+	ids := make([]string, len(edges))
+	for i, e := range edges {
+		ids[i] = e.ID
+	}
+	return ids
+}
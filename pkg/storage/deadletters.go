@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"go.etcd.io/bbolt"
+)
+
+// DeadLetter is a message whose handler failed on every attempt, kept so it
+// can be inspected and re-driven instead of being lost.
+type DeadLetter struct {
+	ID       uint64                    `json:"id"`
+	Message  parser.AntigravityMessage `json:"message"`
+	Source   string                    `json:"source,omitempty"` // what produced the message, e.g. "tail" or "api"
+	Error    string                    `json:"error"`
+	Attempts int                       `json:"attempts"`
+	WorkerID int                       `json:"workerId"`
+	FailedAt time.Time                 `json:"failedAt"`
+}
+
+// SaveDeadLetter stores dl in DeadLetterBucket. A zero ID is assigned the next
+// sequence number; an existing ID overwrites that record, which is how a
+// re-driven message that fails again is updated.
+func (s *BoltStorage) SaveDeadLetter(dl *DeadLetter) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(DeadLetterBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", DeadLetterBucket)
+		}
+		if dl.ID == 0 {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			dl.ID = seq
+		}
+		if dl.FailedAt.IsZero() {
+			dl.FailedAt = time.Now().UTC()
+		}
+		data, err := json.Marshal(dl)
+		if err != nil {
+			return err
+		}
+		return b.Put(deadLetterKey(dl.ID), data)
+	})
+}
+
+// GetDeadLetter returns the dead letter with the given id, or nil if there is
+// none.
+func (s *BoltStorage) GetDeadLetter(id uint64) (*DeadLetter, error) {
+	var dl *DeadLetter
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(DeadLetterBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", DeadLetterBucket)
+		}
+		v := b.Get(deadLetterKey(id))
+		if v == nil {
+			return nil
+		}
+		dl = &DeadLetter{}
+		return json.Unmarshal(v, dl)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dl, nil
+}
+
+// ListDeadLetters returns every dead letter, oldest first.
+func (s *BoltStorage) ListDeadLetters() ([]DeadLetter, error) {
+	var out []DeadLetter
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(DeadLetterBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", DeadLetterBucket)
+		}
+		return b.ForEach(func(_, v []byte) error {
+			var dl DeadLetter
+			if err := json.Unmarshal(v, &dl); err != nil {
+				return err
+			}
+			out = append(out, dl)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DeleteDeadLetter removes a dead letter, typically once it has been
+// re-driven successfully.
+func (s *BoltStorage) DeleteDeadLetter(id uint64) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(DeadLetterBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", DeadLetterBucket)
+		}
+		key := deadLetterKey(id)
+		if b.Get(key) == nil {
+			return fmt.Errorf("dead letter %d: %w", id, ErrNotFound)
+		}
+		return b.Delete(key)
+	})
+}
+
+func deadLetterKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
@@ -0,0 +1,70 @@
+package storage_test
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Dead Letters", func() {
+	var dbStore *storage.BoltStorage
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "deadletters.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	It("stores, updates and removes failed messages in order", func() {
+		first := &storage.DeadLetter{
+			Message:  parser.AntigravityMessage{SessionID: "s1", MessageID: 4, Message: "hi"},
+			Source:   "tail",
+			Error:    "disk full",
+			Attempts: 3,
+			WorkerID: 1,
+		}
+		second := &storage.DeadLetter{Message: parser.AntigravityMessage{SessionID: "s2"}, Error: "boom", Attempts: 1}
+		Expect(dbStore.SaveDeadLetter(first)).To(Succeed())
+		Expect(dbStore.SaveDeadLetter(second)).To(Succeed())
+		Expect(first.ID).To(BeNumerically("<", second.ID))
+		Expect(first.FailedAt).NotTo(BeZero())
+
+		got, err := dbStore.GetDeadLetter(first.ID)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.Message.Message).To(Equal("hi"))
+		Expect(got.Error).To(Equal("disk full"))
+		Expect(got.WorkerID).To(Equal(1))
+
+		got.Attempts += 2
+		Expect(dbStore.SaveDeadLetter(got)).To(Succeed())
+		Expect(dbStore.DeleteDeadLetter(second.ID)).To(Succeed())
+		Expect(dbStore.DeleteDeadLetter(second.ID)).To(MatchError(storage.ErrNotFound))
+
+		all, err := dbStore.ListDeadLetters()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(HaveLen(1))
+		Expect(all[0].Attempts).To(Equal(5))
+	})
+
+	It("keeps each namespace's dead letters apart", func() {
+		ns, err := dbStore.Namespace("team/a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ns.SaveDeadLetter(&storage.DeadLetter{Error: "x"})).To(Succeed())
+
+		top, err := dbStore.ListDeadLetters()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(top).To(BeEmpty())
+
+		missing, err := dbStore.GetDeadLetter(1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeNil())
+	})
+})
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Event is an entry of the change feed: a stored message or a change to the
+// concept graph, as broadcast to live subscribers. Events are kept in
+// EventBucket under an id that increases across the whole namespace, so a
+// subscriber that reconnects can ask for everything after the last id it saw.
+type Event struct {
+	ID   uint64 `json:"id"`
+	Type string `json:"type"`
+	// SessionID is the session the event belongs to, if any; graph changes
+	// have none.
+	SessionID string          `json:"sessionId,omitempty"`
+	Data      json.RawMessage `json:"data"`
+	At        time.Time       `json:"at"`
+}
+
+// AppendEvent stores ev under the next event id, writing the id back into
+// ev. A zero At is set to now.
+func (s *BoltStorage) AppendEvent(ev *Event) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return appendEvent(s.root(tx), ev)
+	})
+}
+
+// AppendEvents stores evs in one transaction under consecutive event ids, in
+// order, writing each id back into its event. A zero At is set to now.
+func (s *BoltStorage) AppendEvents(evs []Event) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for i := range evs {
+			if err := appendEvent(s.root(tx), &evs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func appendEvent(parent bucketParent, ev *Event) error {
+	b := parent.Bucket([]byte(EventBucket))
+	if b == nil {
+		return fmt.Errorf("bucket %s not found", EventBucket)
+	}
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	ev.ID = seq
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	return b.Put(eventKey(ev.ID), data)
+}
+
+// EventsAfter returns up to limit events whose id is greater than after,
+// oldest first. A limit of zero or less means no limit.
+func (s *BoltStorage) EventsAfter(after uint64, limit int) ([]Event, error) {
+	var out []Event
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(EventBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", EventBucket)
+		}
+		var from []byte
+		if after > 0 {
+			from = eventKey(after)
+		}
+		return scanAfter(b, from, limit, func(_, v []byte) (bool, error) {
+			var ev Event
+			if err := json.Unmarshal(v, &ev); err != nil {
+				return false, err
+			}
+			out = append(out, ev)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LastEventID returns the id of the latest event appended, or 0 if there
+// has been none. A subscriber that reads a snapshot of the datastore can
+// resume from it to see every change made since.
+func (s *BoltStorage) LastEventID() (uint64, error) {
+	var id uint64
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(EventBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", EventBucket)
+		}
+		id = b.Sequence()
+		return nil
+	})
+	return id, err
+}
+
+// TrimEvents deletes the events recorded before cutoff and returns how many
+// there were. Subscribers resuming from before the oldest remaining event
+// will have missed the trimmed ones.
+func (s *BoltStorage) TrimEvents(cutoff time.Time) (int, error) {
+	trimmed := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(EventBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", EventBucket)
+		}
+		// Events are appended in time order, so the old ones are a prefix.
+		c := b.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.First() {
+			var ev Event
+			if err := json.Unmarshal(v, &ev); err == nil && !ev.At.Before(cutoff) {
+				break
+			}
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+			trimmed++
+		}
+		return nil
+	})
+	return trimmed, err
+}
+
+func eventKey(id uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, id)
+	return k
+}
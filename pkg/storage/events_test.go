@@ -0,0 +1,71 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Event Log", func() {
+	var dbStore *storage.BoltStorage
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "events.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	It("numbers events in order and reads them back after an id", func() {
+		Expect(dbStore.LastEventID()).To(BeZero())
+		old := time.Now().Add(-time.Hour)
+		for i, typ := range []string{"message", "message", "concept.created"} {
+			ev := &storage.Event{Type: typ, SessionID: "s", Data: json.RawMessage(`{}`)}
+			if i == 0 {
+				ev.At = old
+			}
+			Expect(dbStore.AppendEvent(ev)).To(Succeed())
+			Expect(ev.ID).To(BeEquivalentTo(i + 1))
+		}
+		Expect(dbStore.LastEventID()).To(BeEquivalentTo(3))
+
+		events, err := dbStore.EventsAfter(1, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[1].Type).To(Equal("concept.created"))
+		Expect(events[1].Data).To(MatchJSON(`{}`))
+
+		trimmed, err := dbStore.TrimEvents(time.Now().Add(-time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(trimmed).To(Equal(1))
+		events, err = dbStore.EventsAfter(0, 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events[0].ID).To(BeEquivalentTo(2))
+	})
+
+	It("appends a batch of events under consecutive ids", func() {
+		Expect(dbStore.AppendEvent(&storage.Event{Type: "message", Data: json.RawMessage(`{}`)})).To(Succeed())
+		batch := []storage.Event{
+			{Type: "message", SessionID: "a", Data: json.RawMessage(`{}`)},
+			{Type: "edge.created", Data: json.RawMessage(`{}`)},
+		}
+		Expect(dbStore.AppendEvents(batch)).To(Succeed())
+		Expect(batch[0].ID).To(BeEquivalentTo(2))
+		Expect(batch[1].ID).To(BeEquivalentTo(3))
+		Expect(batch[1].At).NotTo(BeZero())
+
+		events, err := dbStore.EventsAfter(1, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].SessionID).To(Equal("a"))
+		Expect(events[1].Type).To(Equal("edge.created"))
+	})
+})
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"go.etcd.io/bbolt"
+)
+
+// IdempotencyRecord remembers the outcome of a request or message under its
+// idempotency key until ExpiresAt, so a repeat can be answered with the same
+// result instead of being processed again.
+type IdempotencyRecord struct {
+	Key       string    `json:"key"`
+	SessionID string    `json:"sessionId"`
+	MessageID int       `json:"messageId"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (r IdempotencyRecord) expired(now time.Time) bool {
+	return !now.Before(r.ExpiresAt)
+}
+
+// BoltStorage implements parser.Deduper on top of IdempotencyBucket.
+var _ parser.Deduper = (*BoltStorage)(nil)
+
+// ClaimIdempotencyKey stores rec under rec.Key unless a record that has not
+// expired is already there, in which case that record is returned and
+// nothing is written. It returns nil once rec is stored. A zero CreatedAt is
+// set to now, and ttl sets ExpiresAt from it.
+func (s *BoltStorage) ClaimIdempotencyKey(rec IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	if rec.Key == "" {
+		return nil, fmt.Errorf("idempotency key is empty")
+	}
+	var existing *IdempotencyRecord
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(IdempotencyBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", IdempotencyBucket)
+		}
+		var err error
+		existing, err = claimKey(b, &rec, ttl, time.Now().UTC())
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// ReleaseIdempotencyKey forgets key, so the next request that carries it is
+// processed again. It is used when a claimed request did not go through.
+// Releasing a key that is not stored is not an error.
+func (s *BoltStorage) ReleaseIdempotencyKey(key string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(IdempotencyBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", IdempotencyBucket)
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+// PurgeExpiredIdempotencyKeys deletes the records that expired before now
+// and returns how many there were. Expired records are already ignored, so
+// this only reclaims space.
+func (s *BoltStorage) PurgeExpiredIdempotencyKeys(now time.Time) (int, error) {
+	purged := 0
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(IdempotencyBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", IdempotencyBucket)
+		}
+		var stale [][]byte
+		err := b.ForEach(func(k, v []byte) error {
+			var rec IdempotencyRecord
+			// A record that cannot be read is of no use either.
+			if json.Unmarshal(v, &rec) != nil || rec.expired(now) {
+				stale = append(stale, k)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, k := range stale {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		purged = len(stale)
+		return nil
+	})
+	return purged, err
+}
+
+// SeenMessages reports which messages have their parser.DedupKey claimed and
+// not yet expired, without claiming any.
+func (s *BoltStorage) SeenMessages(msgs []parser.AntigravityMessage) ([]bool, error) {
+	seen := make([]bool, len(msgs))
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(IdempotencyBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", IdempotencyBucket)
+		}
+		now := time.Now().UTC()
+		for i, msg := range msgs {
+			v := b.Get([]byte(parser.DedupKey(msg)))
+			if v == nil {
+				continue
+			}
+			var rec IdempotencyRecord
+			seen[i] = json.Unmarshal(v, &rec) == nil && !rec.expired(now)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return seen, nil
+}
+
+// ClaimMessages claims parser.DedupKey of each message in one transaction,
+// reporting which of them were new.
+func (s *BoltStorage) ClaimMessages(msgs []parser.AntigravityMessage, ttl time.Duration) ([]bool, error) {
+	fresh := make([]bool, len(msgs))
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		b := s.root(tx).Bucket([]byte(IdempotencyBucket))
+		if b == nil {
+			return fmt.Errorf("bucket %s not found", IdempotencyBucket)
+		}
+		now := time.Now().UTC()
+		for i, msg := range msgs {
+			rec := IdempotencyRecord{
+				Key:       parser.DedupKey(msg),
+				SessionID: msg.SessionID,
+				MessageID: msg.MessageID,
+			}
+			existing, err := claimKey(b, &rec, ttl, now)
+			if err != nil {
+				return err
+			}
+			fresh[i] = existing == nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fresh, nil
+}
+
+// claimKey is ClaimIdempotencyKey within an open transaction.
+func claimKey(b *bbolt.Bucket, rec *IdempotencyRecord, ttl time.Duration, now time.Time) (*IdempotencyRecord, error) {
+	if v := b.Get([]byte(rec.Key)); v != nil {
+		var existing IdempotencyRecord
+		if err := json.Unmarshal(v, &existing); err == nil && !existing.expired(now) {
+			return &existing, nil
+		}
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = now
+	}
+	rec.ExpiresAt = rec.CreatedAt.Add(ttl)
+	return nil, putJSON(b, rec.Key, rec)
+}
@@ -0,0 +1,90 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Idempotency Keys", func() {
+	var dbStore *storage.BoltStorage
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "idempotency.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	It("returns the first record for a repeated key until it is released", func() {
+		first := storage.IdempotencyRecord{Key: "h:abc", SessionID: "s", MessageID: 3}
+		existing, err := dbStore.ClaimIdempotencyKey(first, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing).To(BeNil())
+
+		existing, err = dbStore.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "h:abc", SessionID: "s", MessageID: 9}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing).NotTo(BeNil())
+		Expect(existing.MessageID).To(Equal(3))
+		Expect(existing.ExpiresAt).To(BeTemporally("~", existing.CreatedAt.Add(time.Hour)))
+
+		Expect(dbStore.ReleaseIdempotencyKey("h:abc")).To(Succeed())
+		existing, err = dbStore.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "h:abc", MessageID: 9}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing).To(BeNil())
+	})
+
+	It("lets an expired key be claimed again and purges it", func() {
+		old := storage.IdempotencyRecord{Key: "h:old", CreatedAt: time.Now().Add(-2 * time.Hour)}
+		_, err := dbStore.ClaimIdempotencyKey(old, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = dbStore.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "h:new"}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+
+		purged, err := dbStore.PurgeExpiredIdempotencyKeys(time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(purged).To(Equal(1))
+
+		existing, err := dbStore.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "h:old"}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing).To(BeNil())
+		existing, err = dbStore.ClaimIdempotencyKey(storage.IdempotencyRecord{Key: "h:new"}, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(existing).NotTo(BeNil())
+	})
+
+	It("claims messages by session and message id or client message id", func() {
+		msgs := []parser.AntigravityMessage{
+			{SessionID: "s", MessageID: 0},
+			{SessionID: "s", MessageID: 1, ClientMessageID: "c-1"},
+			{SessionID: "t", MessageID: 0},
+		}
+		seen, err := dbStore.SeenMessages(msgs)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seen).To(Equal([]bool{false, false, false}))
+
+		fresh, err := dbStore.ClaimMessages(msgs, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fresh).To(Equal([]bool{true, true, true}))
+
+		again := []parser.AntigravityMessage{
+			{SessionID: "s", MessageID: 0},
+			{SessionID: "s", MessageID: 7, ClientMessageID: "c-1"},
+			{SessionID: "s", MessageID: 2},
+		}
+		seen, err = dbStore.SeenMessages(again)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seen).To(Equal([]bool{true, true, false}))
+		fresh, err = dbStore.ClaimMessages(again, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fresh).To(Equal([]bool{false, false, true}))
+	})
+})
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// ErrSelfMerge is returned when asked to merge a concept into itself.
+var ErrSelfMerge = errors.New("cannot merge a concept into itself")
+
+// MergeResult describes what MergeConcepts changed.
+type MergeResult struct {
+	// Concept is the surviving concept, with the other's label and aliases
+	// added to its aliases.
+	Concept Concept `json:"concept"`
+	// Removed is the id of the concept merged away.
+	Removed string `json:"removed"`
+	// Updated lists, once each and in their final state, the edges that now
+	// point at the surviving concept or absorbed a parallel edge.
+	Updated []Edge `json:"updated,omitempty"`
+	// Deleted lists the ids of edges that were dropped: those that joined
+	// the two concepts, and those folded into a parallel edge.
+	Deleted []string `json:"deleted,omitempty"`
+}
+
+// MergeConcepts folds the concept fromID into intoID in one transaction.
+// Edges touching fromID are moved to intoID. An edge between the two
+// concepts is dropped, and one that would duplicate an edge of intoID with
+// the same endpoints and relation is folded into it, adding the evidence it
+// lacks and keeping the larger weight. fromID is then deleted.
+func (s *BoltStorage) MergeConcepts(intoID, fromID string) (*MergeResult, error) {
+	if intoID == fromID {
+		return nil, fmt.Errorf("concept %s: %w", intoID, ErrSelfMerge)
+	}
+
+	var result *MergeResult
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		parent := s.root(tx)
+		into, err := getConcept(parent, intoID)
+		if err != nil {
+			return err
+		}
+		from, err := getConcept(parent, fromID)
+		if err != nil {
+			return err
+		}
+		for id, c := range map[string]*Concept{intoID: into, fromID: from} {
+			if c == nil {
+				return fmt.Errorf("concept %s: %w", id, ErrNotFound)
+			}
+		}
+
+		eb, err := edgeBuckets(parent)
+		if err != nil {
+			return err
+		}
+		now := time.Now().UTC()
+		result = &MergeResult{Removed: fromID}
+
+		// parallel finds intoID's edges by endpoints and relation.
+		type edgeShape struct{ from, to, relation string }
+		parallel := map[edgeShape]*Edge{}
+		for _, id := range append(adjacentEdgeIDs(eb.out, intoID), adjacentEdgeIDs(eb.in, intoID)...) {
+			e, err := eb.get(id)
+			if err != nil {
+				return err
+			}
+			if e != nil {
+				parallel[edgeShape{e.From, e.To, e.Relation}] = e
+			}
+		}
+
+		// updated holds the edges to report, by id, so an edge folded into
+		// more than once is reported once.
+		updated := map[string]*Edge{}
+		moving := append(adjacentEdgeIDs(eb.out, fromID), adjacentEdgeIDs(eb.in, fromID)...)
+		slices.Sort(moving)
+		for _, id := range slices.Compact(moving) {
+			e, err := eb.get(id)
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				continue
+			}
+			if err := eb.delete(id); err != nil {
+				return err
+			}
+			if (e.From == intoID || e.To == intoID) && e.From != e.To {
+				result.Deleted = append(result.Deleted, id)
+				continue
+			}
+
+			if e.From == fromID {
+				e.From = intoID
+			}
+			if e.To == fromID {
+				e.To = intoID
+			}
+			shape := edgeShape{e.From, e.To, e.Relation}
+			if kept, ok := parallel[shape]; ok {
+				for _, ref := range e.Evidence {
+					if !slices.Contains(kept.Evidence, ref) {
+						kept.Evidence = append(kept.Evidence, ref)
+					}
+				}
+				kept.Weight = max(kept.Weight, e.Weight)
+				kept.UpdatedAt = now
+				if err := eb.put(kept); err != nil {
+					return err
+				}
+				result.Deleted = append(result.Deleted, id)
+				updated[kept.ID] = kept
+				continue
+			}
+			e.UpdatedAt = now
+			if err := eb.put(e); err != nil {
+				return err
+			}
+			parallel[shape] = e
+			updated[e.ID] = e
+		}
+		for _, id := range slices.Sorted(maps.Keys(updated)) {
+			result.Updated = append(result.Updated, *updated[id])
+		}
+
+		for _, alias := range append([]string{from.Label}, from.Aliases...) {
+			if alias != into.Label && !slices.Contains(into.Aliases, alias) {
+				into.Aliases = append(into.Aliases, alias)
+			}
+		}
+		if into.FirstSeen == nil {
+			into.FirstSeen = from.FirstSeen
+		}
+		into.UpdatedAt = now
+
+		b, err := conceptBucket(parent)
+		if err != nil {
+			return err
+		}
+		if err := putJSON(b, into.ID, into); err != nil {
+			return err
+		}
+		result.Concept = *into
+		return b.Delete([]byte(fromID))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
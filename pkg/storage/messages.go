@@ -0,0 +1,429 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"go.etcd.io/bbolt"
+)
+
+// Messages live in a nested bucket per session inside ChatBucket:
+//
+//	ChatLogs/<sessionID>/messages/<messageID>         -> JSON AntigravityMessage
+//	ChatLogs/<sessionID>/timeline/<timestamp><msgID>  -> <messageID>
+//
+// Both keys are fixed-width big-endian so bbolt's byte ordering matches
+// numeric and chronological ordering.
+var (
+	messagesBucket = []byte("messages")
+	timelineBucket = []byte("timeline")
+
+	minKeyTime = time.Unix(0, math.MinInt64)
+	maxKeyTime = time.Unix(0, math.MaxInt64)
+)
+
+// SaveMessage stores a message under its session, replacing any previous
+// version with the same message id.
+func (s *BoltStorage) SaveMessage(msg parser.AntigravityMessage) error {
+	if msg.SessionID == "" {
+		return errors.New("message has no session id")
+	}
+	if msg.MessageID < 0 {
+		return fmt.Errorf("invalid message id %d", msg.MessageID)
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return putMessage(s.root(tx), msg, data)
+	})
+}
+
+// SaveMessages stores a batch of messages in a single transaction, which is
+// much faster than calling SaveMessage for each when importing a backlog.
+func (s *BoltStorage) SaveMessages(msgs []parser.AntigravityMessage) error {
+	encoded := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		if msg.SessionID == "" {
+			return errors.New("message has no session id")
+		}
+		if msg.MessageID < 0 {
+			return fmt.Errorf("invalid message id %d", msg.MessageID)
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("encode message: %w", err)
+		}
+		encoded[i] = data
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for i, msg := range msgs {
+			if err := putMessage(s.root(tx), msg, encoded[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// AppendMessage stores msg as the next message of its session, assigning it
+// the id one past the highest id currently stored. The assigned id is written
+// back into msg.
+func (s *BoltStorage) AppendMessage(msg *parser.AntigravityMessage) error {
+	if msg.SessionID == "" {
+		return errors.New("message has no session id")
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		msg.MessageID = lastMessageID(s.root(tx), msg.SessionID) + 1
+
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return fmt.Errorf("encode message: %w", err)
+		}
+		return putMessage(s.root(tx), *msg, data)
+	})
+}
+
+// LastMessageID returns the highest message id stored for a session, or -1
+// if the session has no messages.
+func (s *BoltStorage) LastMessageID(sessionID string) (int, error) {
+	id := -1
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		id = lastMessageID(s.root(tx), sessionID)
+		return nil
+	})
+	return id, err
+}
+
+func lastMessageID(parent bucketParent, sessionID string) int {
+	msgs := sessionSubBucket(parent, sessionID, messagesBucket)
+	if msgs == nil {
+		return -1
+	}
+	k, _ := msgs.Cursor().Last()
+	if k == nil {
+		return -1
+	}
+	return int(binary.BigEndian.Uint64(k))
+}
+
+func putMessage(parent bucketParent, msg parser.AntigravityMessage, data []byte) error {
+	chat := parent.Bucket([]byte(ChatBucket))
+	if chat == nil {
+		return fmt.Errorf("bucket %s not found", ChatBucket)
+	}
+	session, err := chat.CreateBucketIfNotExists([]byte(msg.SessionID))
+	if err != nil {
+		return fmt.Errorf("create session bucket %s: %w", msg.SessionID, err)
+	}
+	msgs, err := session.CreateBucketIfNotExists(messagesBucket)
+	if err != nil {
+		return err
+	}
+	timeline, err := session.CreateBucketIfNotExists(timelineBucket)
+	if err != nil {
+		return err
+	}
+
+	key := messageKey(msg.MessageID)
+
+	// Drop the stale timeline entry if the message is being overwritten.
+	if prev := msgs.Get(key); prev != nil {
+		var old parser.AntigravityMessage
+		if err := json.Unmarshal(prev, &old); err == nil {
+			if err := timeline.Delete(timelineKey(old.Timestamp, old.MessageID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := msgs.Put(key, data); err != nil {
+		return err
+	}
+	return timeline.Put(timelineKey(msg.Timestamp, msg.MessageID), key)
+}
+
+// GetMessage retrieves a single message. It returns nil without an error if
+// the session or message does not exist.
+func (s *BoltStorage) GetMessage(sessionID string, messageID int) (*parser.AntigravityMessage, error) {
+	if messageID < 0 {
+		return nil, nil
+	}
+
+	var msg *parser.AntigravityMessage
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		msgs := sessionSubBucket(s.root(tx), sessionID, messagesBucket)
+		if msgs == nil {
+			return nil
+		}
+		v := msgs.Get(messageKey(messageID))
+		if v == nil {
+			return nil
+		}
+		msg = &parser.AntigravityMessage{}
+		return json.Unmarshal(v, msg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ListSessionMessages returns every message of a session ordered by message id.
+func (s *BoltStorage) ListSessionMessages(sessionID string) ([]parser.AntigravityMessage, error) {
+	var out []parser.AntigravityMessage
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		msgs := sessionSubBucket(s.root(tx), sessionID, messagesBucket)
+		if msgs == nil {
+			return nil
+		}
+		return msgs.ForEach(func(_, v []byte) error {
+			var msg parser.AntigravityMessage
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return err
+			}
+			out = append(out, msg)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListSessionMessagesAfter returns up to limit messages of a session whose
+// id is greater than after, ordered by id. Pass -1 to start from the first
+// message; a limit of zero or less means no limit.
+func (s *BoltStorage) ListSessionMessagesAfter(sessionID string, after, limit int) ([]parser.AntigravityMessage, error) {
+	var out []parser.AntigravityMessage
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		msgs := sessionSubBucket(s.root(tx), sessionID, messagesBucket)
+		if msgs == nil {
+			return nil
+		}
+		var from []byte
+		if after >= 0 {
+			from = messageKey(after)
+		}
+		return scanAfter(msgs, from, limit, func(_, v []byte) (bool, error) {
+			var msg parser.AntigravityMessage
+			if err := json.Unmarshal(v, &msg); err != nil {
+				return false, err
+			}
+			out = append(out, msg)
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MessagesInRange returns the messages of a session whose timestamp falls in
+// the half-open interval [from, to), ordered chronologically.
+func (s *BoltStorage) MessagesInRange(sessionID string, from, to time.Time) ([]parser.AntigravityMessage, error) {
+	var out []parser.AntigravityMessage
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		timeline := sessionSubBucket(s.root(tx), sessionID, timelineBucket)
+		msgs := sessionSubBucket(s.root(tx), sessionID, messagesBucket)
+		if timeline == nil || msgs == nil {
+			return nil
+		}
+
+		lower := timestampKey(from)
+		upper := timestampKey(to)
+
+		c := timeline.Cursor()
+		for k, v := c.Seek(lower); k != nil && bytes.Compare(k[:8], upper) < 0; k, v = c.Next() {
+			raw := msgs.Get(v)
+			if raw == nil {
+				continue
+			}
+			var msg parser.AntigravityMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				return err
+			}
+			out = append(out, msg)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// LatestMessages returns the limit most recent messages of a session by
+// timestamp, ordered chronologically. Only those messages are read, walking
+// the timeline back from its end; a limit of zero or less means no limit.
+func (s *BoltStorage) LatestMessages(sessionID string, limit int) ([]parser.AntigravityMessage, error) {
+	var out []parser.AntigravityMessage
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		timeline := sessionSubBucket(s.root(tx), sessionID, timelineBucket)
+		msgs := sessionSubBucket(s.root(tx), sessionID, messagesBucket)
+		if timeline == nil || msgs == nil {
+			return nil
+		}
+
+		c := timeline.Cursor()
+		for k, v := c.Last(); k != nil && (limit <= 0 || len(out) < limit); k, v = c.Prev() {
+			raw := msgs.Get(v)
+			if raw == nil {
+				continue
+			}
+			var msg parser.AntigravityMessage
+			if err := json.Unmarshal(raw, &msg); err != nil {
+				return err
+			}
+			out = append(out, msg)
+		}
+		slices.Reverse(out)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CreateSession stores an empty session, so that it is listed and can be
+// read before its first message arrives. It fails with ErrExists if the
+// session is already stored.
+func (s *BoltStorage) CreateSession(sessionID string) error {
+	if sessionID == "" {
+		return errors.New("session has no id")
+	}
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		chat := s.root(tx).Bucket([]byte(ChatBucket))
+		if chat == nil {
+			return fmt.Errorf("bucket %s not found", ChatBucket)
+		}
+		if chat.Bucket([]byte(sessionID)) != nil {
+			return fmt.Errorf("session %s: %w", sessionID, ErrExists)
+		}
+		session, err := chat.CreateBucket([]byte(sessionID))
+		if err != nil {
+			return fmt.Errorf("create session bucket %s: %w", sessionID, err)
+		}
+		for _, name := range [][]byte{messagesBucket, timelineBucket} {
+			if _, err := session.CreateBucket(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// SessionExists reports whether a session is stored, with or without
+// messages.
+func (s *BoltStorage) SessionExists(sessionID string) (bool, error) {
+	exists := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		exists = sessionSubBucket(s.root(tx), sessionID, messagesBucket) != nil
+		return nil
+	})
+	return exists, err
+}
+
+// ListSessions returns the ids of all stored sessions.
+func (s *BoltStorage) ListSessions() ([]string, error) {
+	var sessions []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		chat := s.root(tx).Bucket([]byte(ChatBucket))
+		if chat == nil {
+			return fmt.Errorf("bucket %s not found", ChatBucket)
+		}
+		return chat.ForEach(func(k, v []byte) error {
+			// Nested buckets have a nil value; skip raw keys written via Put.
+			if v == nil {
+				sessions = append(sessions, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// ListSessionsAfter returns up to limit session ids that sort after the given
+// one, in order. Pass "" to start from the first session; a limit of zero or
+// less means no limit.
+func (s *BoltStorage) ListSessionsAfter(after string, limit int) ([]string, error) {
+	var sessions []string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		chat := s.root(tx).Bucket([]byte(ChatBucket))
+		if chat == nil {
+			return fmt.Errorf("bucket %s not found", ChatBucket)
+		}
+		return scanAfter(chat, []byte(after), limit, func(k, v []byte) (bool, error) {
+			if v != nil {
+				return false, nil
+			}
+			sessions = append(sessions, string(k))
+			return true, nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func sessionSubBucket(parent bucketParent, sessionID string, name []byte) *bbolt.Bucket {
+	if sessionID == "" {
+		return nil
+	}
+	chat := parent.Bucket([]byte(ChatBucket))
+	if chat == nil {
+		return nil
+	}
+	session := chat.Bucket([]byte(sessionID))
+	if session == nil {
+		return nil
+	}
+	return session.Bucket(name)
+}
+
+func messageKey(id int) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(id))
+	return k
+}
+
+// timestampKey encodes t so that byte order matches chronological order,
+// including instants before the Unix epoch. Times outside the int64
+// nanosecond range (such as the zero time) are clamped to the ends.
+func timestampKey(t time.Time) []byte {
+	var n int64
+	switch {
+	case t.Before(minKeyTime):
+		n = math.MinInt64
+	case t.After(maxKeyTime):
+		n = math.MaxInt64
+	default:
+		n = t.UnixNano()
+	}
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, uint64(n)^(1<<63))
+	return k
+}
+
+func timelineKey(t time.Time, id int) []byte {
+	return append(timestampKey(t), messageKey(id)...)
+}
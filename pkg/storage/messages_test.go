@@ -0,0 +1,219 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Message Store", func() {
+	var (
+		dbStore *storage.BoltStorage
+		base    time.Time
+	)
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "messages.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+		base = time.Date(2025, 9, 4, 21, 0, 0, 0, time.UTC)
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	msg := func(session string, id int, offset time.Duration) parser.AntigravityMessage {
+		return parser.AntigravityMessage{
+			SessionID: session,
+			MessageID: id,
+			Type:      "user",
+			Message:   "hello",
+			Timestamp: base.Add(offset),
+		}
+	}
+
+	It("saves and retrieves a message by session and id", func() {
+		Expect(dbStore.SaveMessage(msg("s1", 7, 0))).To(Succeed())
+
+		got, err := dbStore.GetMessage("s1", 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).NotTo(BeNil())
+		Expect(got.MessageID).To(Equal(7))
+		Expect(got.Timestamp.Equal(base)).To(BeTrue())
+
+		missing, err := dbStore.GetMessage("s1", 8)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeNil())
+
+		missing, err = dbStore.GetMessage("nope", 7)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(missing).To(BeNil())
+	})
+
+	It("keeps the optional client context of a message", func() {
+		m := msg("s1", 1, 0)
+		m.ClientMessageID = "c-1"
+		m.ReplyTo = "c-0"
+		m.Channel = "#general"
+		m.Metadata = map[string]string{"client": "vscode"}
+		Expect(dbStore.SaveMessage(m)).To(Succeed())
+
+		got, err := dbStore.GetMessage("s1", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got.ReplyTo).To(Equal("c-0"))
+		Expect(got.Channel).To(Equal("#general"))
+		Expect(got.Metadata).To(Equal(map[string]string{"client": "vscode"}))
+	})
+
+	It("lists a session in message id order, not insertion order", func() {
+		for _, id := range []int{10, 2, 300, 1} {
+			Expect(dbStore.SaveMessage(msg("s1", id, 0))).To(Succeed())
+		}
+		Expect(dbStore.SaveMessage(msg("s2", 5, 0))).To(Succeed())
+
+		list, err := dbStore.ListSessionMessages("s1")
+		Expect(err).NotTo(HaveOccurred())
+		ids := []int{}
+		for _, m := range list {
+			ids = append(ids, m.MessageID)
+		}
+		Expect(ids).To(Equal([]int{1, 2, 10, 300}))
+
+		sessions, err := dbStore.ListSessions()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sessions).To(ConsistOf("s1", "s2"))
+	})
+
+	It("ranges a session by timestamp", func() {
+		Expect(dbStore.SaveMessage(msg("s1", 0, 3*time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 1, 1*time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 2, 2*time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 3, 5*time.Minute))).To(Succeed())
+
+		list, err := dbStore.MessagesInRange("s1", base.Add(time.Minute), base.Add(5*time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		ids := []int{}
+		for _, m := range list {
+			ids = append(ids, m.MessageID)
+		}
+		Expect(ids).To(Equal([]int{1, 2, 0}))
+	})
+
+	It("reads the latest messages of a session by timestamp", func() {
+		Expect(dbStore.SaveMessage(msg("s1", 0, 3*time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 1, 1*time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 2, 2*time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 3, 5*time.Minute))).To(Succeed())
+
+		ids := func(list []parser.AntigravityMessage) []int {
+			out := []int{}
+			for _, m := range list {
+				out = append(out, m.MessageID)
+			}
+			return out
+		}
+		latest, err := dbStore.LatestMessages("s1", 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(latest)).To(Equal([]int{2, 0, 3}))
+
+		all, err := dbStore.LatestMessages("s1", 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ids(all)).To(Equal([]int{1, 2, 0, 3}))
+
+		none, err := dbStore.LatestMessages("missing", 3)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(none).To(BeEmpty())
+	})
+
+	It("stores sessions created before their first message", func() {
+		Expect(dbStore.CreateSession("empty")).To(Succeed())
+		Expect(dbStore.CreateSession("empty")).To(MatchError(storage.ErrExists))
+
+		exists, err := dbStore.SessionExists("empty")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeTrue())
+		exists, err = dbStore.SessionExists("missing")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exists).To(BeFalse())
+
+		sessions, err := dbStore.ListSessions()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sessions).To(ConsistOf("empty"))
+		last, err := dbStore.LastMessageID("empty")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(last).To(Equal(-1))
+
+		Expect(dbStore.SaveMessage(msg("empty", 0, 0))).To(Succeed())
+		list, err := dbStore.ListSessionMessages("empty")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list).To(HaveLen(1))
+	})
+
+	It("moves an overwritten message to its new position on the timeline", func() {
+		Expect(dbStore.SaveMessage(msg("s1", 0, time.Minute))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s1", 0, time.Hour))).To(Succeed())
+
+		early, err := dbStore.MessagesInRange("s1", base, base.Add(10*time.Minute))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(early).To(BeEmpty())
+
+		late, err := dbStore.MessagesInRange("s1", base, base.Add(2*time.Hour))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(late).To(HaveLen(1))
+	})
+
+	It("appends messages with the next free id in their session", func() {
+		Expect(dbStore.SaveMessage(msg("s1", 4, 0))).To(Succeed())
+
+		next := msg("s1", 0, time.Minute)
+		Expect(dbStore.AppendMessage(&next)).To(Succeed())
+		Expect(next.MessageID).To(Equal(5))
+
+		first := msg("fresh", 99, 0)
+		Expect(dbStore.AppendMessage(&first)).To(Succeed())
+		Expect(first.MessageID).To(Equal(0))
+
+		got, err := dbStore.GetMessage("s1", 5)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(got).NotTo(BeNil())
+	})
+
+	It("pages through sessions and their messages", func() {
+		for _, id := range []int{0, 1, 2, 3, 4} {
+			Expect(dbStore.SaveMessage(msg("s1", id, 0))).To(Succeed())
+		}
+		Expect(dbStore.SaveMessage(msg("s2", 0, 0))).To(Succeed())
+		Expect(dbStore.SaveMessage(msg("s3", 0, 0))).To(Succeed())
+
+		page, err := dbStore.ListSessionMessagesAfter("s1", -1, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page).To(HaveLen(2))
+		Expect(page[1].MessageID).To(Equal(1))
+
+		page, err = dbStore.ListSessionMessagesAfter("s1", 1, 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page).To(HaveLen(3))
+		Expect(page[0].MessageID).To(Equal(2))
+
+		page, err = dbStore.ListSessionMessagesAfter("missing", -1, 2)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page).To(BeEmpty())
+
+		sessions, err := dbStore.ListSessionsAfter("s1", 1)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sessions).To(Equal([]string{"s2"}))
+		sessions, err = dbStore.ListSessionsAfter("", 0)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sessions).To(Equal([]string{"s1", "s2", "s3"}))
+	})
+
+	It("rejects messages without a session id", func() {
+		Expect(dbStore.SaveMessage(msg("", 0, 0))).NotTo(Succeed())
+	})
+})
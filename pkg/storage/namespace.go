@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"go.etcd.io/bbolt"
+)
+
+// Namespace scopes messages, concepts and edges so that unrelated brainstorms
+// can share one database. It is a slash-separated path whose segments are up
+// to the caller, e.g. "acme/roadmap/2026-10-18" for project, subject and date,
+// or "acme/users/brett" for an individual. The empty Namespace is the
+// unscoped top level.
+//
+// Each namespace is a bucket inside NamespaceBucket keyed by its full path,
+// holding its own ChatLogs, Concepts and Edges buckets.
+type Namespace string
+
+// NewNamespace joins scope segments into a Namespace.
+func NewNamespace(segments ...string) Namespace {
+	return Namespace(strings.Join(segments, "/"))
+}
+
+// Segments splits the namespace into its path segments.
+func (ns Namespace) Segments() []string {
+	if ns == "" {
+		return nil
+	}
+	return strings.Split(string(ns), "/")
+}
+
+// Contains reports whether other is ns itself or nested below it.
+func (ns Namespace) Contains(other Namespace) bool {
+	return ns == "" || other == ns || strings.HasPrefix(string(other), string(ns)+"/")
+}
+
+func (ns Namespace) validate() error {
+	for _, seg := range ns.Segments() {
+		if seg == "" {
+			return fmt.Errorf("invalid namespace %q: empty segment", ns)
+		}
+		if strings.ContainsRune(seg, 0) {
+			return fmt.Errorf("invalid namespace %q: contains NUL", ns)
+		}
+	}
+	return nil
+}
+
+// Namespace returns a view of the datastore scoped to ns, creating the
+// namespace on first use. The view shares the underlying database, so Close
+// on any view closes it for all of them.
+func (s *BoltStorage) Namespace(ns Namespace) (*BoltStorage, error) {
+	if ns == "" {
+		return &BoltStorage{db: s.db}, nil
+	}
+	if err := ns.validate(); err != nil {
+		return nil, err
+	}
+
+	err := s.db.Update(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(NamespaceBucket))
+		if root == nil {
+			return fmt.Errorf("bucket %s not found", NamespaceBucket)
+		}
+		b, err := root.CreateBucketIfNotExists([]byte(ns))
+		if err != nil {
+			return fmt.Errorf("create namespace %s: %w", ns, err)
+		}
+		for _, name := range dataBuckets {
+			if _, err := b.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("create bucket %s in namespace %s: %w", name, ns, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BoltStorage{db: s.db, ns: ns}, nil
+}
+
+// ExistingNamespace returns a view of the datastore scoped to ns like
+// Namespace, but without creating it: a namespace that does not exist yet is
+// an error wrapping ErrNotFound.
+func (s *BoltStorage) ExistingNamespace(ns Namespace) (*BoltStorage, error) {
+	if ns == "" {
+		return &BoltStorage{db: s.db}, nil
+	}
+	found := false
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(NamespaceBucket))
+		if root == nil {
+			return fmt.Errorf("bucket %s not found", NamespaceBucket)
+		}
+		found = root.Bucket([]byte(ns)) != nil
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("namespace %s: %w", ns, ErrNotFound)
+	}
+	return &BoltStorage{db: s.db, ns: ns}, nil
+}
+
+// CurrentNamespace returns the namespace this view is scoped to.
+func (s *BoltStorage) CurrentNamespace() Namespace {
+	return s.ns
+}
+
+// ListNamespaces returns the namespaces contained in prefix (all of them for
+// an empty prefix), sorted by path. The unscoped top level is not listed.
+func (s *BoltStorage) ListNamespaces(prefix Namespace) ([]Namespace, error) {
+	var out []Namespace
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		root := tx.Bucket([]byte(NamespaceBucket))
+		if root == nil {
+			return fmt.Errorf("bucket %s not found", NamespaceBucket)
+		}
+		return root.ForEach(func(k, v []byte) error {
+			if ns := Namespace(k); v == nil && prefix.Contains(ns) {
+				out = append(out, ns)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Scoped pairs a query result with the namespace it came from.
+type Scoped[T any] struct {
+	Namespace Namespace `json:"namespace"`
+	Item      T         `json:"item"`
+}
+
+// Across runs query against each of the given namespaces and merges the
+// results, tagging every item with its namespace. Each namespace is read in
+// its own transaction; namespaces that do not exist are skipped rather than
+// created. For example:
+//
+//	concepts, err := storage.Across(store, nss, (*storage.BoltStorage).ListConcepts)
+func Across[T any](s *BoltStorage, namespaces []Namespace, query func(*BoltStorage) ([]T, error)) ([]Scoped[T], error) {
+	sorted := append([]Namespace(nil), namespaces...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var out []Scoped[T]
+	for i, ns := range sorted {
+		if i > 0 && ns == sorted[i-1] {
+			continue
+		}
+		view, err := s.ExistingNamespace(ns)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		items, err := query(view)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		for _, item := range items {
+			out = append(out, Scoped[T]{Namespace: ns, Item: item})
+		}
+	}
+	return out, nil
+}
+
+// bucketParent is satisfied by both *bbolt.Tx and *bbolt.Bucket, so the data
+// buckets can be looked up at the top level or inside a namespace alike.
+type bucketParent interface {
+	Bucket(name []byte) *bbolt.Bucket
+}
+
+// root returns the parent of this view's data buckets.
+func (s *BoltStorage) root(tx *bbolt.Tx) bucketParent {
+	if s.ns == "" {
+		return tx
+	}
+	if nsRoot := tx.Bucket([]byte(NamespaceBucket)); nsRoot != nil {
+		if b := nsRoot.Bucket([]byte(s.ns)); b != nil {
+			return b
+		}
+	}
+	return missingNamespace{}
+}
+
+// missingNamespace stands in for a namespace bucket that has gone away, so
+// lookups fail with the usual "bucket not found" errors instead of panicking.
+type missingNamespace struct{}
+
+func (missingNamespace) Bucket([]byte) *bbolt.Bucket { return nil }
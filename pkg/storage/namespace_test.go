@@ -0,0 +1,111 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/parser"
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Namespaced Storage", func() {
+	var dbStore *storage.BoltStorage
+
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "ns.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	scope := func(segments ...string) *storage.BoltStorage {
+		view, err := dbStore.Namespace(storage.NewNamespace(segments...))
+		Expect(err).NotTo(HaveOccurred())
+		return view
+	}
+
+	It("keeps identically keyed data in different namespaces apart", func() {
+		acme := scope("acme", "roadmap")
+		globex := scope("globex", "roadmap")
+
+		Expect(acme.CreateConcept(&storage.Concept{ID: "idea", Label: "rockets"})).To(Succeed())
+		Expect(globex.CreateConcept(&storage.Concept{ID: "idea", Label: "volcano lair"})).To(Succeed())
+
+		msg := parser.AntigravityMessage{SessionID: "s1", Type: "user", Message: "hi", Timestamp: time.Now()}
+		Expect(acme.SaveMessage(msg)).To(Succeed())
+
+		a, err := acme.GetConcept("idea")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(a.Label).To(Equal("rockets"))
+
+		g, err := globex.GetConcept("idea")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(g.Label).To(Equal("volcano lair"))
+
+		top, err := dbStore.GetConcept("idea")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(top).To(BeNil())
+
+		sessions, err := globex.ListSessions()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sessions).To(BeEmpty())
+	})
+
+	It("lists namespaces, optionally below a prefix", func() {
+		scope("acme", "roadmap")
+		scope("acme", "retro")
+		scope("acme-labs")
+		scope("globex")
+
+		all, err := dbStore.ListNamespaces("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(Equal([]storage.Namespace{"acme-labs", "acme/retro", "acme/roadmap", "globex"}))
+
+		acme, err := dbStore.ListNamespaces("acme")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(acme).To(Equal([]storage.Namespace{"acme/retro", "acme/roadmap"}))
+	})
+
+	It("merges queries across several namespaces", func() {
+		Expect(scope("a").CreateConcept(&storage.Concept{ID: "x", Label: "X"})).To(Succeed())
+		Expect(scope("b").CreateConcept(&storage.Concept{ID: "y", Label: "Y"})).To(Succeed())
+		Expect(scope("c").CreateConcept(&storage.Concept{ID: "z", Label: "Z"})).To(Succeed())
+
+		merged, err := storage.Across(dbStore, []storage.Namespace{"b", "a"}, (*storage.BoltStorage).ListConcepts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged).To(HaveLen(2))
+		Expect(merged[0].Namespace).To(Equal(storage.Namespace("a")))
+		Expect(merged[0].Item.ID).To(Equal("x"))
+		Expect(merged[1].Namespace).To(Equal(storage.Namespace("b")))
+		Expect(merged[1].Item.ID).To(Equal("y"))
+	})
+
+	It("skips namespaces that do not exist instead of creating them", func() {
+		Expect(scope("a").CreateConcept(&storage.Concept{ID: "x", Label: "X"})).To(Succeed())
+
+		merged, err := storage.Across(dbStore, []storage.Namespace{"a", "ghost"}, (*storage.BoltStorage).ListConcepts)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(merged).To(HaveLen(1))
+
+		all, err := dbStore.ListNamespaces("")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(all).To(Equal([]storage.Namespace{"a"}))
+
+		_, err = dbStore.ExistingNamespace("ghost")
+		Expect(err).To(MatchError(storage.ErrNotFound))
+		view, err := dbStore.ExistingNamespace("a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(view.CurrentNamespace()).To(Equal(storage.Namespace("a")))
+	})
+
+	It("rejects malformed namespaces", func() {
+		_, err := dbStore.Namespace("acme//roadmap")
+		Expect(err).To(HaveOccurred())
+	})
+})
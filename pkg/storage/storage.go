@@ -2,21 +2,32 @@ package storage
 
 import (
 	"fmt"
+	"slices"
 
 	"go.etcd.io/bbolt"
 )
 
 // BoltStorage provides an interface for the embedded BoltDB datastore.
+// A BoltStorage returned by Namespace reads and writes only that namespace.
 type BoltStorage struct {
 	db *bbolt.DB
+	ns Namespace
 }
 
 const (
-	ChatBucket    = "ChatLogs"
-	ConceptBucket = "Concepts"
-	EdgeBucket    = "Edges"
+	ChatBucket        = "ChatLogs"
+	ConceptBucket     = "Concepts"
+	EdgeBucket        = "Edges"
+	CheckpointBucket  = "Checkpoints"
+	DeadLetterBucket  = "DeadLetters"
+	IdempotencyBucket = "IdempotencyKeys"
+	EventBucket       = "Events"
+	NamespaceBucket   = "Namespaces"
 )
 
+// dataBuckets are the buckets present at the top level and in every namespace.
+var dataBuckets = []string{ChatBucket, ConceptBucket, EdgeBucket, CheckpointBucket, DeadLetterBucket, IdempotencyBucket, EventBucket}
+
 // NewBoltStorage opens the database at the given path and sets up initial buckets.
 func NewBoltStorage(path string) (*BoltStorage, error) {
 	// Open the db with default options
@@ -27,7 +38,7 @@ func NewBoltStorage(path string) (*BoltStorage, error) {
 
 	// Initialize buckets
 	err = db.Update(func(tx *bbolt.Tx) error {
-		buckets := []string{ChatBucket, ConceptBucket, EdgeBucket}
+		buckets := slices.Concat(dataBuckets, []string{NamespaceBucket})
 		for _, b := range buckets {
 			_, err := tx.CreateBucketIfNotExists([]byte(b))
 			if err != nil {
@@ -45,6 +56,13 @@ func NewBoltStorage(path string) (*BoltStorage, error) {
 	return &BoltStorage{db: db}, nil
 }
 
+// Sync flushes the database file to disk. Every committed transaction is
+// already synced unless the database was opened with NoSync, so this only
+// matters on shutdown paths that want to be sure.
+func (s *BoltStorage) Sync() error {
+	return s.db.Sync()
+}
+
 // Close gracefully closes the database connection.
 func (s *BoltStorage) Close() error {
 	return s.db.Close()
@@ -53,7 +71,7 @@ func (s *BoltStorage) Close() error {
 // Put saves a key-value pair in a specified bucket.
 func (s *BoltStorage) Put(bucket, key string, value []byte) error {
 	return s.db.Update(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+		b := s.root(tx).Bucket([]byte(bucket))
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
@@ -65,7 +83,7 @@ func (s *BoltStorage) Put(bucket, key string, value []byte) error {
 func (s *BoltStorage) Get(bucket, key string) ([]byte, error) {
 	var val []byte
 	err := s.db.View(func(tx *bbolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+		b := s.root(tx).Bucket([]byte(bucket))
 		if b == nil {
 			return fmt.Errorf("bucket %s not found", bucket)
 		}
@@ -7,6 +7,7 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/gnomatix/enkente/pkg/parser"
 	"github.com/gnomatix/enkente/pkg/storage"
 )
 
@@ -58,4 +59,16 @@ var _ = Describe("Embedded Storage Engine", func() {
 		Expect(err).To(HaveOccurred())
 		Expect(err.Error()).To(ContainSubstring("not found"))
 	})
+	It("persists tailer checkpoints by log path", func() {
+		cp, err := dbStore.LoadCheckpoint("/logs/a.ndjson")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp).To(BeNil())
+
+		Expect(dbStore.SaveCheckpoint(parser.Checkpoint{Path: "/logs/a.ndjson", Offset: 42, LastMessageID: 7})).To(Succeed())
+
+		cp, err = dbStore.LoadCheckpoint("/logs/a.ndjson")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cp.Offset).To(BeEquivalentTo(42))
+		Expect(cp.LastMessageID).To(Equal(7))
+	})
 })
@@ -0,0 +1,304 @@
+package storage
+
+import (
+	"sort"
+
+	"go.etcd.io/bbolt"
+)
+
+// Direction selects which edges a traversal follows from a concept.
+type Direction int
+
+const (
+	// Outgoing follows edges from From to To.
+	Outgoing Direction = iota
+	// Incoming follows edges from To back to From.
+	Incoming
+	// Both ignores edge direction.
+	Both
+)
+
+// Subgraph is a set of concepts together with the edges connecting them.
+type Subgraph struct {
+	Concepts []Concept `json:"concepts"`
+	Edges    []Edge    `json:"edges"`
+}
+
+// Each traversal below runs inside a single bbolt read transaction, so it sees
+// one consistent snapshot of the graph even while ingestion keeps writing.
+
+// Neighborhood returns every concept within hops steps of id, plus the edges
+// walked to reach them. It returns nil without an error if id does not exist.
+func (s *BoltStorage) Neighborhood(id string, hops int, dir Direction) (*Subgraph, error) {
+	var sub *Subgraph
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		g, err := newGraphView(s.root(tx))
+		if err != nil {
+			return err
+		}
+		root, err := g.concept(id)
+		if err != nil || root == nil {
+			return err
+		}
+
+		sub = &Subgraph{Concepts: []Concept{*root}}
+		seenConcepts := map[string]bool{id: true}
+		seenEdges := map[string]bool{}
+		frontier := []string{id}
+
+		for depth := 0; depth < hops && len(frontier) > 0; depth++ {
+			var next []string
+			for _, cur := range frontier {
+				edges, err := g.edges(cur, dir)
+				if err != nil {
+					return err
+				}
+				for _, e := range edges {
+					if !seenEdges[e.ID] {
+						seenEdges[e.ID] = true
+						sub.Edges = append(sub.Edges, e)
+					}
+					other := e.other(cur)
+					if seenConcepts[other] {
+						continue
+					}
+					seenConcepts[other] = true
+					c, err := g.concept(other)
+					if err != nil {
+						return err
+					}
+					if c != nil {
+						sub.Concepts = append(sub.Concepts, *c)
+					}
+					next = append(next, other)
+				}
+			}
+			frontier = next
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sub, nil
+}
+
+// ShortestPath returns the edges of a path with the fewest hops from one
+// concept to another. It returns nil if no path exists and an empty slice if
+// from and to are the same concept.
+func (s *BoltStorage) ShortestPath(from, to string, dir Direction) ([]Edge, error) {
+	var path []Edge
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		g, err := newGraphView(s.root(tx))
+		if err != nil {
+			return err
+		}
+		if c, err := g.concept(from); err != nil || c == nil {
+			return err
+		}
+		if from == to {
+			path = []Edge{}
+			return nil
+		}
+
+		// Breadth-first search remembering the edge used to reach each concept.
+		via := map[string]Edge{}
+		visited := map[string]bool{from: true}
+		queue := []string{from}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+
+			edges, err := g.edges(cur, dir)
+			if err != nil {
+				return err
+			}
+			for _, e := range edges {
+				other := e.other(cur)
+				if visited[other] {
+					continue
+				}
+				visited[other] = true
+				via[other] = e
+				if other == to {
+					for node := to; node != from; {
+						step := via[node]
+						path = append(path, step)
+						node = step.other(node)
+					}
+					for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+						path[i], path[j] = path[j], path[i]
+					}
+					return nil
+				}
+				queue = append(queue, other)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+// ConnectedComponents partitions all concepts into weakly connected
+// components. Each component lists its concept ids in order, and components
+// are ordered largest first.
+func (s *BoltStorage) ConnectedComponents() ([][]string, error) {
+	var components [][]string
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		g, err := newGraphView(s.root(tx))
+		if err != nil {
+			return err
+		}
+
+		var ids []string
+		if err := g.concepts.ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k))
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		visited := map[string]bool{}
+		for _, start := range ids {
+			if visited[start] {
+				continue
+			}
+			visited[start] = true
+			component := []string{start}
+			queue := []string{start}
+			for len(queue) > 0 {
+				cur := queue[0]
+				queue = queue[1:]
+				edges, err := g.edges(cur, Both)
+				if err != nil {
+					return err
+				}
+				for _, e := range edges {
+					other := e.other(cur)
+					if !visited[other] {
+						visited[other] = true
+						component = append(component, other)
+						queue = append(queue, other)
+					}
+				}
+			}
+			sort.Strings(component)
+			components = append(components, component)
+		}
+
+		sort.SliceStable(components, func(i, j int) bool {
+			return len(components[i]) > len(components[j])
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return components, nil
+}
+
+// ReachableVia returns every concept reachable from id by following outgoing
+// edges of the given relation any number of times. The starting concept is
+// not included unless a cycle leads back to it.
+func (s *BoltStorage) ReachableVia(id, relation string) ([]Concept, error) {
+	var out []Concept
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		g, err := newGraphView(s.root(tx))
+		if err != nil {
+			return err
+		}
+
+		visited := map[string]bool{}
+		queue := []string{id}
+		for len(queue) > 0 {
+			cur := queue[0]
+			queue = queue[1:]
+			edges, err := g.edges(cur, Outgoing)
+			if err != nil {
+				return err
+			}
+			for _, e := range edges {
+				if e.Relation != relation || visited[e.To] {
+					continue
+				}
+				visited[e.To] = true
+				c, err := g.concept(e.To)
+				if err != nil {
+					return err
+				}
+				if c != nil {
+					out = append(out, *c)
+				}
+				queue = append(queue, e.To)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// other returns the endpoint of e opposite to id.
+func (e Edge) other(id string) string {
+	if e.From == id {
+		return e.To
+	}
+	return e.From
+}
+
+// graphView reads concepts and edges from one transaction.
+type graphView struct {
+	parent   bucketParent
+	concepts *bbolt.Bucket
+	index    *edgeIndex
+}
+
+func newGraphView(parent bucketParent) (*graphView, error) {
+	concepts, err := conceptBucket(parent)
+	if err != nil {
+		return nil, err
+	}
+	index, err := edgeBuckets(parent)
+	if err != nil {
+		return nil, err
+	}
+	return &graphView{parent: parent, concepts: concepts, index: index}, nil
+}
+
+func (g *graphView) concept(id string) (*Concept, error) {
+	return getConcept(g.parent, id)
+}
+
+// edges returns the edges leaving id in the given direction. For Both, a
+// self-loop is reported once.
+func (g *graphView) edges(id string, dir Direction) ([]Edge, error) {
+	var ids []string
+	if dir == Outgoing || dir == Both {
+		ids = append(ids, adjacentEdgeIDs(g.index.out, id)...)
+	}
+	if dir == Incoming || dir == Both {
+		ids = append(ids, adjacentEdgeIDs(g.index.in, id)...)
+	}
+
+	seen := make(map[string]bool, len(ids))
+	edges := make([]Edge, 0, len(ids))
+	for _, edgeID := range ids {
+		if seen[edgeID] {
+			continue
+		}
+		seen[edgeID] = true
+		e, err := g.index.get(edgeID)
+		if err != nil {
+			return nil, err
+		}
+		if e != nil {
+			edges = append(edges, *e)
+		}
+	}
+	return edges, nil
+}
@@ -0,0 +1,90 @@
+package storage_test
+
+import (
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/gnomatix/enkente/pkg/storage"
+)
+
+var _ = Describe("Graph Traversal", func() {
+	var dbStore *storage.BoltStorage
+
+	// a -is_a-> b -is_a-> c -relates-> d      e -is_a-> f
+	BeforeEach(func() {
+		store, err := storage.NewBoltStorage(filepath.Join(GinkgoT().TempDir(), "traverse.db"))
+		Expect(err).NotTo(HaveOccurred())
+		dbStore = store
+
+		for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+			Expect(dbStore.CreateConcept(&storage.Concept{ID: id, Label: id})).To(Succeed())
+		}
+		for _, e := range []storage.Edge{
+			{ID: "ab", From: "a", To: "b", Relation: "is_a"},
+			{ID: "bc", From: "b", To: "c", Relation: "is_a"},
+			{ID: "cd", From: "c", To: "d", Relation: "relates"},
+			{ID: "ef", From: "e", To: "f", Relation: "is_a"},
+		} {
+			Expect(dbStore.CreateEdge(&e)).To(Succeed())
+		}
+	})
+
+	AfterEach(func() {
+		Expect(dbStore.Close()).To(Succeed())
+	})
+
+	conceptIDs := func(cs []storage.Concept) []string {
+		ids := make([]string, len(cs))
+		for i, c := range cs {
+			ids[i] = c.ID
+		}
+		return ids
+	}
+
+	It("returns the k-hop neighborhood of a concept", func() {
+		sub, err := dbStore.Neighborhood("b", 1, storage.Both)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conceptIDs(sub.Concepts)).To(ConsistOf("a", "b", "c"))
+		Expect(edgeIDs(sub.Edges)).To(ConsistOf("ab", "bc"))
+
+		sub, err = dbStore.Neighborhood("b", 2, storage.Outgoing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conceptIDs(sub.Concepts)).To(ConsistOf("b", "c", "d"))
+
+		sub, err = dbStore.Neighborhood("missing", 2, storage.Both)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sub).To(BeNil())
+	})
+
+	It("finds the shortest path respecting direction", func() {
+		path, err := dbStore.ShortestPath("a", "d", storage.Outgoing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(path)).To(Equal([]string{"ab", "bc", "cd"}))
+
+		path, err = dbStore.ShortestPath("d", "a", storage.Outgoing)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(BeNil())
+
+		path, err = dbStore.ShortestPath("d", "a", storage.Both)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(edgeIDs(path)).To(Equal([]string{"cd", "bc", "ab"}))
+
+		path, err = dbStore.ShortestPath("a", "f", storage.Both)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(path).To(BeNil())
+	})
+
+	It("partitions the graph into connected components", func() {
+		components, err := dbStore.ConnectedComponents()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(components).To(Equal([][]string{{"a", "b", "c", "d"}, {"e", "f"}}))
+	})
+
+	It("follows a single relation transitively", func() {
+		reach, err := dbStore.ReachableVia("a", "is_a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conceptIDs(reach)).To(Equal([]string{"b", "c"}))
+	})
+})
@@ -55,3 +55,23 @@ func AllUserColors() []lipgloss.Color {
 // SystemColor is the reserved color for system/AI messages.
 // Grand Budapest Hotel muted rose — distinct from all user palette colors.
 var SystemColor = lipgloss.Color("#7294D4")
+
+// UserColor returns the color a chat participant is shown in: SystemColor
+// for system messages, otherwise a color from AllUserColors picked by a
+// hash of the user's name, or of the message type when there is no user.
+// The web viewer repeats this hash, so the two must change together.
+func UserColor(user, msgType string) lipgloss.Color {
+	if msgType == "system" {
+		return SystemColor
+	}
+	identity := user
+	if identity == "" {
+		identity = msgType
+	}
+	hash := uint(0)
+	for _, c := range identity {
+		hash = hash*31 + uint(c)
+	}
+	palette := AllUserColors()
+	return palette[hash%uint(len(palette))]
+}